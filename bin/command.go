@@ -1,78 +1,71 @@
 package bin
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"fmt"
-	"go_collector/utils"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 const CmdTimeout = 10 * time.Second
 
-func RunCommand(filename string, args ...string) ([]byte, error) {
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, CmdTimeout)
-	defer cancel()
+// ChecksumFile lists the sha256 checksums of the programs in a tool
+// directory, in the format of sha256sum. When it exists, only the programs
+// it lists are run from that directory.
+const ChecksumFile = "SHA256SUMS"
 
-	rootDir := utils.GetBinDir()
-	osType := utils.GetOsType()
-	switch osType {
-	case "linux":
-		filename = rootDir + "/" + filename
-	case "windows":
-		filename = rootDir + "\\" + filename
-	default:
-		fmt.Println("Unknown OS")
+// bundledChecksum returns the checksum listed for filename in the
+// ChecksumFile of dir, or "" if there is no such file.
+func bundledChecksum(dir, filename string) (string, error) {
+	f, err := os.Open(filepath.Join(dir, ChecksumFile))
+	if os.IsNotExist(err) {
+		return "", nil
 	}
-	fmt.Println("cmd:", filename+" "+strings.Join(args, " "))
-	cmd := exec.CommandContext(ctx, filename, args...)
-	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return out, err
+		return "", err
 	}
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			fmt.Println("Exec command timeout")
-		} else {
-			return out, err
+	defer f.Close()
+
+	name := filepath.ToSlash(filename)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// A leading '*' marks a checksum computed in binary mode.
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
 		}
 	}
-
-	return out, nil
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("couldn't read %s: %w", ChecksumFile, err)
+	}
+	return "", &ChecksumError{Path: filepath.Join(dir, filename)}
 }
 
-func RunCommandAndReturnBytes(filename string, args ...string) bytes.Buffer {
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, CmdTimeout)
-	defer cancel()
-
-	rootDir := utils.GetBinDir()
-	osType := utils.GetOsType()
-	switch osType {
-	case "linux":
-		filename = rootDir + "/" + filename
-	case "windows":
-		filename = rootDir + "\\" + filename
-	default:
-		fmt.Println("Unknown OS")
-	}
-	cmd := exec.CommandContext(ctx, filename, args...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println("Run RunCommandAndReturnBytes Error: ", filename)
-	}
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			fmt.Println("Exec command timeout")
-		} else {
-			fmt.Println("Run RunCommandAndReturnBytes Error: ", filename, err.Error())
-		}
-	}
+// Script describes a program run from an arbitrary path rather than the bin
+// directory.
+type Script struct {
+	Path string
+	Args []string
+	// Dir is the working directory; empty means the current directory.
+	Dir string
+	// Env is added to the environment inherited from this process.
+	Env []string
+	// Timeout defaults to CmdTimeout.
+	Timeout time.Duration
+}
 
-	return out
+// RunScript runs s and returns its standard output. If s exits non-zero,
+// the *ExitError includes its standard error.
+func RunScript(s Script) ([]byte, error) {
+	res, err := Run(context.Background(), Command{
+		Path:    s.Path,
+		Args:    s.Args,
+		Dir:     s.Dir,
+		Env:     s.Env,
+		Timeout: s.Timeout,
+	})
+	return res.Stdout, err
 }
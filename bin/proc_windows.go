@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package bin
+
+import "os/exec"
+
+// setProcessGroup leaves cmd unchanged: cancelling it kills only the
+// process itself.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,99 @@
+package bin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var unsafeRecordingChars = regexp.MustCompile(`[^A-Za-z0-9._=-]`)
+
+// RecordingName is the base name of the files holding the recorded output
+// of cmd: the program name and the arguments, with the characters unsafe in
+// file names replaced by '_'. The directory of the program is left out, so
+// that recordings do not depend on where a tool is installed.
+func RecordingName(cmd Command) string {
+	words := append([]string{filepath.Base(cmd.Path)}, cmd.Args...)
+	return unsafeRecordingChars.ReplaceAllString(strings.Join(words, " "), "_")
+}
+
+// ReplayRunner serves recorded command outputs from Dir instead of running
+// commands: RecordingName(cmd) + ".stdout", and optionally ".stderr" and
+// ".exitcode".
+type ReplayRunner struct {
+	Dir string
+}
+
+// Run implements Runner.
+func (r ReplayRunner) Run(ctx context.Context, cmd Command) (Result, error) {
+	base := filepath.Join(r.Dir, RecordingName(cmd))
+	stdout, err := os.ReadFile(base + ".stdout")
+	if err != nil {
+		return Result{ExitCode: -1}, fmt.Errorf("no recorded output for %s: %w", cmd, err)
+	}
+	res := Result{Stdout: stdout}
+	if res.Stderr, err = os.ReadFile(base + ".stderr"); err != nil && !os.IsNotExist(err) {
+		return res, err
+	}
+	if code, err := os.ReadFile(base + ".exitcode"); err == nil {
+		if res.ExitCode, err = strconv.Atoi(strings.TrimSpace(string(code))); err != nil {
+			return res, fmt.Errorf("invalid recorded exit code for %s: %w", cmd, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return res, err
+	}
+	if res.ExitCode != 0 {
+		return res, &ExitError{Path: cmd.Path, Code: res.ExitCode, Stderr: strings.TrimSpace(string(res.Stderr))}
+	}
+	return res, nil
+}
+
+// Replay makes commands and tools be served from the recordings in dir.
+// Tools are then resolved to their bare name and not looked up.
+func Replay(dir string) {
+	SetRunner(ReplayRunner{Dir: dir})
+	DefaultResolver.mtx.Lock()
+	defer DefaultResolver.mtx.Unlock()
+	DefaultResolver.Dirs = nil
+	DefaultResolver.LookPath = func(file string) (string, error) { return file, nil }
+}
+
+// RecordingRunner runs commands with Runner and keeps the results of those
+// that ran, by RecordingName, for a ReplayRunner.
+type RecordingRunner struct {
+	Runner Runner
+
+	mtx        sync.Mutex
+	recordings map[string]Result
+}
+
+// Run implements Runner.
+func (r *RecordingRunner) Run(ctx context.Context, cmd Command) (Result, error) {
+	res, err := r.Runner.Run(ctx, cmd)
+	// Commands that could not start or were killed have nothing to replay.
+	if res.ExitCode >= 0 {
+		r.mtx.Lock()
+		if r.recordings == nil {
+			r.recordings = map[string]Result{}
+		}
+		r.recordings[RecordingName(cmd)] = res
+		r.mtx.Unlock()
+	}
+	return res, err
+}
+
+// Recordings returns the results recorded so far by recording name.
+func (r *RecordingRunner) Recordings() map[string]Result {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	recordings := make(map[string]Result, len(r.recordings))
+	for name, res := range r.recordings {
+		recordings[name] = res
+	}
+	return recordings
+}
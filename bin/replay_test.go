@@ -0,0 +1,75 @@
+package bin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordingName(t *testing.T) {
+	cmd := Command{Path: "/usr/sbin/smartctl", Args: []string{"--json=c", "-a", "/dev/sda [SAT]", "-d", "sat"}}
+	if got, want := RecordingName(cmd), "smartctl_--json=c_-a__dev_sda__SAT__-d_sat"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestReplayRunner(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"smartctl_--scan.stdout":        "/dev/sda -d sat\n",
+		"smartctl_-a__dev_sda.stdout":   "{\"partial\": true}\n",
+		"smartctl_-a__dev_sda.stderr":   "checksum error\n",
+		"smartctl_-a__dev_sda.exitcode": "4\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := ReplayRunner{Dir: dir}
+
+	res, err := r.Run(context.Background(), Command{Path: "/opt/bin/smartctl", Args: []string{"--scan"}})
+	if err != nil || string(res.Stdout) != "/dev/sda -d sat\n" {
+		t.Errorf("unexpected replay %q, %v", res.Stdout, err)
+	}
+
+	res, err = r.Run(context.Background(), Command{Path: "smartctl", Args: []string{"-a", "/dev/sda"}})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 4 || exitErr.Stderr != "checksum error" {
+		t.Errorf("expected the recorded exit code and stderr, got %v", err)
+	}
+	if string(res.Stdout) != "{\"partial\": true}\n" {
+		t.Errorf("expected the output along with the error, got %q", res.Stdout)
+	}
+
+	if _, err := r.Run(context.Background(), Command{Path: "ipmitool", Args: []string{"sdr"}}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing recording error, got %v", err)
+	}
+}
+
+func TestRecordingRunner(t *testing.T) {
+	r := &RecordingRunner{Runner: RunnerFunc(func(ctx context.Context, cmd Command) (Result, error) {
+		switch cmd.Args[0] {
+		case "--scan":
+			return Result{Stdout: []byte("/dev/sda -d sat\n")}, nil
+		case "-a":
+			return Result{Stdout: []byte("{}\n"), ExitCode: 4}, &ExitError{Path: cmd.Path, Code: 4}
+		}
+		return Result{ExitCode: -1}, &TimeoutError{Path: cmd.Path}
+	})}
+	for _, args := range [][]string{{"--scan"}, {"-a", "/dev/sda"}, {"--hang"}} {
+		r.Run(context.Background(), Command{Path: "/usr/sbin/smartctl", Args: args})
+	}
+
+	got := r.Recordings()
+	if len(got) != 2 {
+		t.Fatalf("expected the commands that ran to be recorded, got %v", got)
+	}
+	if res := got["smartctl_--scan"]; string(res.Stdout) != "/dev/sda -d sat\n" {
+		t.Errorf("unexpected recording %q", res.Stdout)
+	}
+	if res := got["smartctl_-a__dev_sda"]; res.ExitCode != 4 {
+		t.Errorf("expected the exit code to be recorded, got %d", res.ExitCode)
+	}
+}
@@ -0,0 +1,235 @@
+package bin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxOutput is the default number of bytes kept from each of the standard
+// output and the standard error of a command.
+const MaxOutput = 16 << 20
+
+// Command describes one run of a program.
+type Command struct {
+	Path string
+	Args []string
+	// Dir is the working directory; empty means the current directory.
+	Dir string
+	// Env is added to the environment inherited from this process.
+	Env []string
+	// Timeout defaults to CmdTimeout.
+	Timeout time.Duration
+	// MaxOutput limits each output stream and defaults to MaxOutput. A
+	// command writing more is killed.
+	MaxOutput int64
+	// SHA256 is the expected hex checksum of Path; empty skips the check.
+	SHA256 string
+}
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+// Result is the output of a command. Stdout and Stderr hold what was
+// written before the command exited or was killed.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Runner runs commands. Tests replace it with SetRunner.
+type Runner interface {
+	Run(ctx context.Context, cmd Command) (Result, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface.
+type RunnerFunc func(ctx context.Context, cmd Command) (Result, error)
+
+// Run implements Runner.
+func (f RunnerFunc) Run(ctx context.Context, cmd Command) (Result, error) {
+	return f(ctx, cmd)
+}
+
+// TimeoutError is returned when a command was killed after its timeout.
+type TimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Path, e.Timeout)
+}
+
+// ExitError is returned when a command exits with a non-zero code.
+type ExitError struct {
+	Path   string
+	Code   int
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%s: exit status %d: %s", e.Path, e.Code, e.Stderr)
+	}
+	return fmt.Sprintf("%s: exit status %d", e.Path, e.Code)
+}
+
+// OutputLimitError is returned when a command was killed for writing more
+// than its output limit.
+type OutputLimitError struct {
+	Path  string
+	Limit int64
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("%s: output exceeds %d bytes", e.Path, e.Limit)
+}
+
+// ChecksumError is returned, without running the command, when the program
+// does not have the expected checksum. Want is empty when no checksum is
+// known for it.
+type ChecksumError struct {
+	Path string
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("%s: no checksum listed in %s", e.Path, ChecksumFile)
+	}
+	return fmt.Sprintf("%s: sha256 %s does not match %s", e.Path, e.Got, e.Want)
+}
+
+var (
+	runnerMtx sync.RWMutex
+	runner    Runner = ExecRunner{}
+)
+
+// SetRunner replaces the Runner used by Run, and so by RunScript, RunTool
+// and the Resolvers, and returns a function restoring the previous one.
+func SetRunner(r Runner) (restore func()) {
+	runnerMtx.Lock()
+	defer runnerMtx.Unlock()
+	prev := runner
+	runner = r
+	return func() { SetRunner(prev) }
+}
+
+// Run runs cmd with the current Runner.
+func Run(ctx context.Context, cmd Command) (Result, error) {
+	runnerMtx.RLock()
+	r := runner
+	runnerMtx.RUnlock()
+	return r.Run(ctx, cmd)
+}
+
+// ExecRunner runs commands as child processes. The process group of the
+// command is killed on timeout, so that the children it started do not
+// outlive it.
+type ExecRunner struct{}
+
+var errOutputLimit = errors.New("output limit exceeded")
+
+// Run implements Runner.
+func (ExecRunner) Run(ctx context.Context, c Command) (Result, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = CmdTimeout
+	}
+	limit := c.MaxOutput
+	if limit <= 0 {
+		limit = MaxOutput
+	}
+	if c.SHA256 != "" {
+		if err := verifyChecksum(c.Path, c.SHA256); err != nil {
+			return Result{ExitCode: -1}, err
+		}
+	}
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
+	runCtx, cancel := context.WithCancelCause(timeoutCtx)
+	defer cancel(nil)
+
+	cmd := exec.CommandContext(runCtx, c.Path, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = append(os.Environ(), c.Env...)
+	setProcessGroup(cmd)
+	// Children that inherited stdout could otherwise keep Wait waiting
+	// long after the command itself was killed.
+	cmd.WaitDelay = time.Second
+	exceeded := func() { cancel(errOutputLimit) }
+	stdout := &limitedBuffer{limit: limit, exceeded: exceeded}
+	stderr := &limitedBuffer{limit: limit, exceeded: exceeded}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err := cmd.Run()
+	res := Result{Stdout: stdout.buf.Bytes(), Stderr: stderr.buf.Bytes(), ExitCode: -1}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	switch {
+	case context.Cause(runCtx) == errOutputLimit:
+		return res, &OutputLimitError{Path: c.Path, Limit: limit}
+	case ctx.Err() != nil:
+		return res, ctx.Err()
+	case timeoutCtx.Err() == context.DeadlineExceeded:
+		return res, &TimeoutError{Path: c.Path, Timeout: timeout}
+	case err == nil:
+		return res, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && res.ExitCode > 0 {
+		return res, &ExitError{Path: c.Path, Code: res.ExitCode, Stderr: strings.TrimSpace(string(res.Stderr))}
+	}
+	return res, fmt.Errorf("%s: %w", c.Path, err)
+}
+
+// limitedBuffer keeps the first limit bytes written to it and reports when
+// more are written.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= room {
+		return b.buf.Write(p)
+	}
+	if room > 0 {
+		b.buf.Write(p[:room])
+	}
+	b.exceeded()
+	// Keep draining the pipe until the command is killed.
+	return len(p), nil
+}
+
+func verifyChecksum(path, want string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return &ChecksumError{Path: path, Want: want, Got: got}
+	}
+	return nil
+}
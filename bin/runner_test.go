@@ -0,0 +1,129 @@
+//go:build !windows
+// +build !windows
+
+package bin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func shell(script string) Command {
+	return Command{Path: "/bin/sh", Args: []string{"-c", script}, Timeout: 5 * time.Second}
+}
+
+func TestExecRunner(t *testing.T) {
+	res, err := ExecRunner{}.Run(context.Background(), shell("echo out; echo warning >&2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "out\n" || string(res.Stderr) != "warning\n" || res.ExitCode != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestExecRunnerExitCode(t *testing.T) {
+	res, err := ExecRunner{}.Run(context.Background(), shell(`echo '{"partial": true}'; echo failing >&2; exit 4`))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an ExitError, got %v", err)
+	}
+	if exitErr.Code != 4 || exitErr.Stderr != "failing" {
+		t.Errorf("unexpected error %+v", exitErr)
+	}
+	if string(res.Stdout) != "{\"partial\": true}\n" {
+		t.Errorf("expected the output along with the error, got %q", res.Stdout)
+	}
+}
+
+func TestExecRunnerTimeoutKillsProcessGroup(t *testing.T) {
+	cmd := shell("sleep 30 & sleep 30")
+	cmd.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := ExecRunner{}.Run(context.Background(), cmd)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a TimeoutError, got %v", err)
+	}
+	// The background sleep holds stdout; killing only the shell would make
+	// Run wait for WaitDelay.
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("expected the process group to be killed, took %s", elapsed)
+	}
+}
+
+func TestExecRunnerOutputLimit(t *testing.T) {
+	cmd := shell("while :; do echo line; done")
+	cmd.MaxOutput = 1024
+	res, err := ExecRunner{}.Run(context.Background(), cmd)
+	var limitErr *OutputLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected an OutputLimitError, got %v", err)
+	}
+	if len(res.Stdout) != 1024 {
+		t.Errorf("expected 1024 bytes of output, got %d", len(res.Stdout))
+	}
+}
+
+func TestExecRunnerChecksum(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho ok\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The sha256 of an empty file.
+	const other = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	_, err := ExecRunner{}.Run(context.Background(), Command{Path: tool, SHA256: other})
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a ChecksumError, got %v", err)
+	}
+	res, err := ExecRunner{}.Run(context.Background(), Command{Path: tool, SHA256: checksumErr.Got})
+	if err != nil || string(res.Stdout) != "ok\n" {
+		t.Errorf("expected the tool to run, got %q, %v", res.Stdout, err)
+	}
+}
+
+func TestBundledChecksum(t *testing.T) {
+	dir := t.TempDir()
+	if sum, err := bundledChecksum(dir, "smartctl"); sum != "" || err != nil {
+		t.Errorf("expected no check without %s, got %q, %v", ChecksumFile, sum, err)
+	}
+
+	sums := "0123abcd  ipmitool\n4567ef01 *smartctl/smartctl.exe\n"
+	if err := os.WriteFile(filepath.Join(dir, ChecksumFile), []byte(sums), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := bundledChecksum(dir, "ipmitool"); sum != "0123abcd" || err != nil {
+		t.Errorf("unexpected checksum %q, %v", sum, err)
+	}
+	if sum, err := bundledChecksum(dir, filepath.Join("smartctl", "smartctl.exe")); sum != "4567ef01" || err != nil {
+		t.Errorf("unexpected checksum %q, %v", sum, err)
+	}
+	var checksumErr *ChecksumError
+	if _, err := bundledChecksum(dir, "dmidecode"); !errors.As(err, &checksumErr) {
+		t.Errorf("expected a ChecksumError for an unlisted tool, got %v", err)
+	}
+}
+
+func TestSetRunner(t *testing.T) {
+	var got Command
+	restore := SetRunner(RunnerFunc(func(ctx context.Context, cmd Command) (Result, error) {
+		got = cmd
+		return Result{Stdout: []byte("recorded\n")}, nil
+	}))
+	defer restore()
+
+	out, err := RunScript(Script{Path: "/opt/check.sh", Args: []string{"-v"}})
+	if err != nil || string(out) != "recorded\n" {
+		t.Fatalf("unexpected output %q, %v", out, err)
+	}
+	if got.String() != "/opt/check.sh -v" {
+		t.Errorf("unexpected command %q", got)
+	}
+}
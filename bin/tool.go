@@ -0,0 +1,235 @@
+package bin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_collector/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log/level"
+)
+
+var toolDirs = kingpin.Flag("tools.dir", "Directory searched for external tools before the bin directory next to the executable and $PATH. May be repeated.").Strings()
+
+// ErrToolNotFound is returned when a tool is in none of the searched
+// directories nor in $PATH.
+var ErrToolNotFound = errors.New("tool not found")
+
+// Tool is an external program run by the agent.
+type Tool struct {
+	Name string
+	// Files are the paths tried in each tool directory, relative to it.
+	// They default to Name. $PATH is searched for Name.
+	Files []string
+	// VersionArgs make the tool print its version, matched by
+	// VersionPattern whose first group is the version.
+	VersionArgs    []string
+	VersionPattern string
+	// MinVersion is the oldest usable dotted version; empty accepts any.
+	MinVersion string
+}
+
+// ResolvedTool is where a tool was found and which version it is. Err is
+// set when it was not found or is unusable.
+type ResolvedTool struct {
+	Name     string
+	Path     string
+	Version  string
+	Duration time.Duration
+	Err      error
+	// checksum is the one listed for a tool found in a tool directory.
+	checksum string
+}
+
+// Resolver finds tools in a list of directories, then in $PATH. Tools are
+// resolved once, the first time they are run.
+type Resolver struct {
+	// Dirs returns the tool directories, in search order.
+	Dirs func() []string
+	// LookPath searches $PATH and defaults to exec.LookPath.
+	LookPath func(file string) (string, error)
+
+	mtx      sync.Mutex
+	tools    map[string]Tool
+	resolved map[string]*ResolvedTool
+}
+
+// DefaultResolver searches the --tools.dir directories, then the bin
+// directory next to the executable.
+var DefaultResolver = &Resolver{
+	Dirs: func() []string {
+		return append(append([]string{}, *toolDirs...), utils.GetBinDir())
+	},
+}
+
+// RegisterTool registers t with the DefaultResolver.
+func RegisterTool(t Tool) {
+	DefaultResolver.Register(t)
+}
+
+// RunTool runs a tool registered with the DefaultResolver, see
+// Resolver.Run.
+func RunTool(name string, args ...string) ([]byte, error) {
+	return DefaultResolver.Run(context.Background(), name, args...)
+}
+
+// ResolvedTools returns the tools the DefaultResolver resolved so far.
+func ResolvedTools() []ResolvedTool {
+	return DefaultResolver.Resolved()
+}
+
+// Register adds t to the tools r can run.
+func (r *Resolver) Register(t Tool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.tools == nil {
+		r.tools = map[string]Tool{}
+	}
+	r.tools[t.Name] = t
+}
+
+// Resolve returns where the tool called name is, resolving it on first use.
+func (r *Resolver) Resolve(ctx context.Context, name string) (ResolvedTool, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if rt, ok := r.resolved[name]; ok {
+		return *rt, rt.Err
+	}
+	t, ok := r.tools[name]
+	if !ok {
+		return ResolvedTool{}, fmt.Errorf("unknown tool %q", name)
+	}
+	begin := time.Now()
+	rt := r.resolve(ctx, t)
+	rt.Duration = time.Since(begin)
+	if rt.Err != nil {
+		level.Warn(utils.Logger()).Log("msg", "Tool unavailable", "tool", name, "err", rt.Err)
+	} else {
+		level.Debug(utils.Logger()).Log("msg", "Resolved tool", "tool", name, "path", rt.Path, "version", rt.Version)
+	}
+	if r.resolved == nil {
+		r.resolved = map[string]*ResolvedTool{}
+	}
+	r.resolved[name] = &rt
+	return rt, rt.Err
+}
+
+func (r *Resolver) resolve(ctx context.Context, t Tool) ResolvedTool {
+	rt := ResolvedTool{Name: t.Name}
+	files := t.Files
+	if len(files) == 0 {
+		files = []string{t.Name}
+	}
+	var dirs []string
+	if r.Dirs != nil {
+		dirs = r.Dirs()
+	}
+
+search:
+	for _, dir := range dirs {
+		for _, file := range files {
+			path := filepath.Join(dir, file)
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			checksum, err := bundledChecksum(dir, file)
+			if err != nil {
+				rt.Err = err
+				return rt
+			}
+			rt.Path, rt.checksum = path, checksum
+			break search
+		}
+	}
+	if rt.Path == "" {
+		lookPath := r.LookPath
+		if lookPath == nil {
+			lookPath = exec.LookPath
+		}
+		path, err := lookPath(t.Name)
+		if err != nil {
+			rt.Err = fmt.Errorf("%w: %s is not in %s nor $PATH", ErrToolNotFound, t.Name, strings.Join(dirs, ", "))
+			return rt
+		}
+		rt.Path = path
+	}
+
+	if t.VersionPattern == "" {
+		return rt
+	}
+	res, err := Run(ctx, Command{Path: rt.Path, Args: t.VersionArgs, SHA256: rt.checksum})
+	if err != nil {
+		rt.Err = fmt.Errorf("couldn't get the %s version: %w", t.Name, err)
+		return rt
+	}
+	m := regexp.MustCompile(t.VersionPattern).FindSubmatch(res.Stdout)
+	if m == nil {
+		rt.Err = fmt.Errorf("couldn't find the %s version in %q", t.Name, firstLine(res.Stdout))
+		return rt
+	}
+	rt.Version = string(m[1])
+	if t.MinVersion != "" && !versionAtLeast(rt.Version, t.MinVersion) {
+		rt.Err = fmt.Errorf("%s %s is older than the required %s", t.Name, rt.Version, t.MinVersion)
+	}
+	return rt
+}
+
+// Run runs the tool called name and returns its standard output. Errors are
+// *TimeoutError, *ExitError, *OutputLimitError or *ChecksumError when
+// applicable; the output is returned along with an *ExitError since some
+// tools exit non-zero to report what they found.
+func (r *Resolver) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	rt, err := r.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	cmd := Command{Path: rt.Path, Args: args, SHA256: rt.checksum}
+	level.Debug(utils.Logger()).Log("msg", "Running command", "cmd", cmd.String())
+	res, err := Run(ctx, cmd)
+	return res.Stdout, err
+}
+
+// Resolved returns the tools resolved so far, ordered by name.
+func (r *Resolver) Resolved() []ResolvedTool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	tools := make([]ResolvedTool, 0, len(r.resolved))
+	for _, rt := range r.resolved {
+		tools = append(tools, *rt)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// versionAtLeast compares dotted versions numerically; missing parts are 0.
+func versionAtLeast(version, min string) bool {
+	v, m := strings.Split(version, "."), strings.Split(min, ".")
+	for i := 0; i < len(v) || i < len(m); i++ {
+		var a, b int
+		if i < len(v) {
+			a, _ = strconv.Atoi(v[i])
+		}
+		if i < len(m) {
+			b, _ = strconv.Atoi(m[i])
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return true
+}
+
+func firstLine(b []byte) string {
+	line, _, _ := strings.Cut(string(b), "\n")
+	return line
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package bin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSmartctl writes a fake smartctl printing version to dir.
+func writeSmartctl(t *testing.T, dir, version string) string {
+	t.Helper()
+	path := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo 'smartctl " + version + " 2022-02-28 r5338 [x86_64-linux-6.1.0] (local build)'; else echo \"$@\"; fi\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestResolver(dirs ...string) *Resolver {
+	r := &Resolver{Dirs: func() []string { return dirs }}
+	r.Register(Tool{
+		Name:           "smartctl",
+		VersionArgs:    []string{"--version"},
+		VersionPattern: `smartctl (\d+(?:\.\d+)*)`,
+		MinVersion:     "7.0",
+	})
+	return r
+}
+
+func TestResolverSearchOrder(t *testing.T) {
+	configured, bundled, system := t.TempDir(), t.TempDir(), t.TempDir()
+	writeSmartctl(t, bundled, "7.3")
+	writeSmartctl(t, system, "7.4")
+	t.Setenv("PATH", system)
+
+	rt, err := newTestResolver(configured, bundled).Resolve(context.Background(), "smartctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Path != filepath.Join(bundled, "smartctl") || rt.Version != "7.3" {
+		t.Errorf("expected the bundled smartctl 7.3, got %s %s", rt.Path, rt.Version)
+	}
+
+	rt, err = newTestResolver(configured).Resolve(context.Background(), "smartctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Path != filepath.Join(system, "smartctl") || rt.Version != "7.4" {
+		t.Errorf("expected smartctl 7.4 from $PATH, got %s %s", rt.Path, rt.Version)
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+
+	r := newTestResolver(dir)
+	if _, err := r.Run(context.Background(), "smartctl", "--scan"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("expected ErrToolNotFound, got %v", err)
+	}
+
+	writeSmartctl(t, dir, "6.6")
+	r = newTestResolver(dir)
+	if _, err := r.Run(context.Background(), "smartctl", "--scan"); err == nil {
+		t.Error("expected smartctl 6.6 to be rejected")
+	}
+	tools := r.Resolved()
+	if len(tools) != 1 || tools[0].Version != "6.6" || tools[0].Err == nil {
+		t.Errorf("expected the rejected smartctl to be reported, got %+v", tools)
+	}
+}
+
+func TestResolverRun(t *testing.T) {
+	dir := t.TempDir()
+	writeSmartctl(t, dir, "7.3")
+	r := newTestResolver(dir)
+	out, err := r.Run(context.Background(), "smartctl", "--json=c", "--scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "--json=c --scan\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if _, err := r.Run(context.Background(), "ipmitool"); err == nil {
+		t.Error("expected an error for an unregistered tool")
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for _, test := range []struct {
+		version, min string
+		want         bool
+	}{
+		{"7.3", "7.0", true},
+		{"7", "7.0", true},
+		{"6.6", "7.0", false},
+		{"10.1", "7.0", true},
+		{"7.0.1", "7.1", false},
+	} {
+		if got := versionAtLeast(test.version, test.min); got != test.want {
+			t.Errorf("versionAtLeast(%q, %q) = %t, want %t", test.version, test.min, got, test.want)
+		}
+	}
+}
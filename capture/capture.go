@@ -0,0 +1,172 @@
+// Package capture archives what the collectors read from a host and the
+// output of the commands run during a collection, in the snapshot layout
+// replayed with --fixtures.dir.
+package capture
+
+import (
+	"fmt"
+	"go_collector/bin"
+	"go_collector/utils/ttar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// maxFileSize is the size above which a file is left out of the archive.
+const maxFileSize = 4 << 20
+
+// Archiver writes host files and command recordings to a ttar archive.
+type Archiver struct {
+	tw *ttar.Writer
+	// roots maps the top directories of the snapshot layout to the host.
+	roots  map[string]string
+	seen   map[string]bool
+	logger log.Logger
+}
+
+// NewArchiver returns an Archiver writing to tw, reading the top directories
+// of the snapshot layout (proc, sys, udev/data) from roots.
+func NewArchiver(tw *ttar.Writer, roots map[string]string, logger log.Logger) *Archiver {
+	return &Archiver{tw: tw, roots: roots, seen: map[string]bool{}, logger: logger}
+}
+
+// AddGlob archives the host files matching glob, a path of the snapshot
+// layout. Directories are archived recursively, and symbolic links with the
+// entry they point to, as long as it is under the same root.
+func (a *Archiver) AddGlob(glob string) error {
+	prefix, root, rest, ok := a.root(glob)
+	if !ok {
+		return fmt.Errorf("%q is not under %s", glob, strings.Join(a.prefixes(), ", "))
+	}
+	matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(rest)))
+	if err != nil {
+		return fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	for _, match := range matches {
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return err
+		}
+		a.add(path.Join(prefix, filepath.ToSlash(rel)), match, true)
+	}
+	return nil
+}
+
+func (a *Archiver) root(name string) (prefix, root, rest string, ok bool) {
+	for _, prefix := range a.prefixes() {
+		if name == prefix {
+			return prefix, a.roots[prefix], "", true
+		}
+		if rest, ok := strings.CutPrefix(name, prefix+"/"); ok {
+			return prefix, a.roots[prefix], rest, true
+		}
+	}
+	return "", "", "", false
+}
+
+func (a *Archiver) prefixes() []string {
+	prefixes := make([]string, 0, len(a.roots))
+	for prefix := range a.roots {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// add archives the host file as name. Only the symbolic links matched by a
+// glob are followed, so that walking sys does not wander into every device.
+func (a *Archiver) add(name, host string, follow bool) {
+	if a.seen[name] {
+		return
+	}
+	a.seen[name] = true
+
+	info, err := os.Lstat(host)
+	if err != nil {
+		level.Debug(a.logger).Log("msg", "Skipping file", "file", host, "err", err)
+		return
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(host)
+		if err != nil {
+			level.Debug(a.logger).Log("msg", "Skipping symlink", "file", host, "err", err)
+			return
+		}
+		a.tw.Symlink(name, target)
+		if !follow || filepath.IsAbs(target) {
+			return
+		}
+		targetName := path.Join(path.Dir(name), filepath.ToSlash(target))
+		if prefix, _, _, ok := a.root(name); ok && strings.HasPrefix(targetName, prefix+"/") {
+			a.add(targetName, filepath.Join(filepath.Dir(host), target), false)
+		}
+	case info.IsDir():
+		entries, err := os.ReadDir(host)
+		if err != nil {
+			level.Debug(a.logger).Log("msg", "Skipping directory", "dir", host, "err", err)
+			return
+		}
+		a.tw.Dir(name, info.Mode())
+		for _, e := range entries {
+			a.add(path.Join(name, e.Name()), filepath.Join(host, e.Name()), false)
+		}
+	case info.Mode().IsRegular():
+		data, err := readFile(host)
+		if err != nil {
+			level.Debug(a.logger).Log("msg", "Skipping file", "file", host, "err", err)
+			return
+		}
+		a.tw.File(name, data, info.Mode())
+	}
+}
+
+// readFile reads a file up to maxFileSize. The size of proc and sys files
+// is not known before reading them.
+func readFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxFileSize)
+	}
+	return data, nil
+}
+
+// AddRecordings archives command results under commands/, as read by
+// bin.ReplayRunner.
+func (a *Archiver) AddRecordings(recordings map[string]bin.Result) {
+	names := make([]string, 0, len(recordings))
+	for name := range recordings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := recordings[name]
+		a.tw.File(path.Join("commands", name+".stdout"), res.Stdout, 0o644)
+		if len(res.Stderr) > 0 {
+			a.tw.File(path.Join("commands", name+".stderr"), res.Stderr, 0o644)
+		}
+		if res.ExitCode != 0 {
+			a.tw.File(path.Join("commands", name+".exitcode"), []byte(strconv.Itoa(res.ExitCode)+"\n"), 0o644)
+		}
+	}
+}
+
+// AddFile archives data as name.
+func (a *Archiver) AddFile(name string, data []byte) {
+	a.tw.File(name, data, 0o644)
+}
@@ -0,0 +1,110 @@
+package capture
+
+import (
+	"bytes"
+	"go_collector/bin"
+	"go_collector/utils/ttar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	host := t.TempDir()
+	writeFiles(t, host, map[string]string{
+		"proc/meminfo":                   "MemTotal: 1024 kB\n",
+		"proc/stat":                      "cpu 1 2 3\n",
+		"sys/devices/virtual/net/lo/mtu": "65536\n",
+		"sys/devices/virtual/net/lo/queues/rx-0/rps_cpus": "0\n",
+		"sys/devices/virtual/misc/tun/dev":                "10:200\n",
+		"data/b8:0":                                       "E:ID_MODEL=disk\n",
+	})
+	for link, target := range map[string]string{
+		"sys/class/net/lo":                 "../../devices/virtual/net/lo",
+		"sys/devices/virtual/net/lo/tun":   "../../misc/tun",
+		"sys/devices/virtual/net/lo/owner": "/etc/passwd",
+	} {
+		p := filepath.Join(host, link)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots := map[string]string{
+		"proc":      filepath.Join(host, "proc"),
+		"sys":       filepath.Join(host, "sys"),
+		"udev/data": filepath.Join(host, "data"),
+	}
+
+	var buf bytes.Buffer
+	tw := ttar.NewWriter(&buf, "")
+	a := NewArchiver(tw, roots, log.NewNopLogger())
+	for _, glob := range []string{"proc/meminfo", "sys/class/net/*", "udev/data/b*", "proc/missing"} {
+		if err := a.AddGlob(glob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.AddGlob("etc/passwd"); err == nil {
+		t.Error("expected an error for a glob outside of the snapshot layout")
+	}
+	a.AddRecordings(map[string]bin.Result{
+		"smartctl_--scan":      {Stdout: []byte("/dev/sda -d sat\n")},
+		"smartctl_-a__dev_sda": {Stdout: []byte("{}\n"), Stderr: []byte("checksum error\n"), ExitCode: 4},
+	})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := ttar.Extract(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"proc/meminfo":                           "MemTotal: 1024 kB\n",
+		"sys/class/net/lo/mtu":                   "65536\n",
+		"sys/class/net/lo/queues/rx-0/rps_cpus":  "0\n",
+		"udev/data/b8:0":                         "E:ID_MODEL=disk\n",
+		"commands/smartctl_--scan.stdout":        "/dev/sda -d sat\n",
+		"commands/smartctl_-a__dev_sda.stdout":   "{}\n",
+		"commands/smartctl_-a__dev_sda.stderr":   "checksum error\n",
+		"commands/smartctl_-a__dev_sda.exitcode": "4\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s: want %q, got %q", name, want, got)
+		}
+	}
+	for _, name := range []string{
+		// Only the links matched by a glob are followed.
+		"sys/devices/virtual/misc/tun/dev",
+		"proc/stat",
+		"commands/smartctl_--scan.stderr",
+		"commands/smartctl_--scan.exitcode",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s: expected not to be captured, got %v", name, err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "sys/devices/virtual/net/lo/owner")); err != nil || target != "/etc/passwd" {
+		t.Errorf("expected the link to be kept as is, got %q, %v", target, err)
+	}
+}
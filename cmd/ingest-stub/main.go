@@ -0,0 +1,61 @@
+// Command ingest-stub is a local stand-in for the HOST endpoint. It accepts
+// payloads pushed by the agent, validates them and stores them on disk, and
+// can inject latency and failures to exercise the agent's error paths.
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/common/promlog/flag"
+)
+
+func main() {
+	var (
+		listenAddress = kingpin.Flag(
+			"web.listen-address",
+			"Address on which to accept payloads.",
+		).Default(":8901").String()
+		storageDir = kingpin.Flag(
+			"storage.dir",
+			"Directory accepted payloads are written to, one file per payload.",
+		).Default("payloads").String()
+		errorRate = kingpin.Flag(
+			"fault.error-rate",
+			"Fraction of requests, between 0 and 1, that are rejected with --fault.error-status.",
+		).Default("0").Float64()
+		errorStatus = kingpin.Flag(
+			"fault.error-status",
+			"HTTP status code returned for injected failures.",
+		).Default("503").Int()
+		latency = kingpin.Flag(
+			"fault.latency",
+			"Delay added before every response.",
+		).Default("0s").Duration()
+	)
+
+	promlogConfig := &promlog.Config{}
+	flag.AddFlags(kingpin.CommandLine, promlogConfig)
+	kingpin.HelpFlag.Short('h')
+	kingpin.Parse()
+	logger := promlog.New(promlogConfig)
+
+	s, err := newServer(logger, *storageDir, faults{
+		ErrorRate:   *errorRate,
+		ErrorStatus: *errorStatus,
+		Latency:     *latency,
+	})
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to create server", "err", err)
+		os.Exit(1)
+	}
+
+	level.Info(logger).Log("msg", "Listening", "address", *listenAddress, "storage_dir", *storageDir)
+	if err := http.ListenAndServe(*listenAddress, s); err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+}
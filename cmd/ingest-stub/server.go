@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"go_collector/handle"
+	"go_collector/push"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxPayloadBytes bounds the size of a single accepted payload.
+const maxPayloadBytes = 64 << 20
+
+// faults describes the failures the stub injects into incoming requests.
+type faults struct {
+	// ErrorRate is the probability in [0, 1] that a request is rejected
+	// with ErrorStatus before it is validated.
+	ErrorRate   float64
+	ErrorStatus int
+	// Latency is added before every response.
+	Latency time.Duration
+}
+
+// server accepts pushed payloads, validates them against
+// handle.CollectDataStruct and stores each accepted payload as a file.
+// Patches pushed with --push.delta are applied to the last payload accepted
+// from the same client host, and the result is stored.
+type server struct {
+	logger log.Logger
+	dir    string
+	faults faults
+	seq    atomic.Uint64
+
+	mtx     sync.Mutex
+	streams map[string]stream
+}
+
+// stream is the last payload accepted from a client in delta mode.
+type stream struct {
+	seq     uint64
+	payload []byte
+}
+
+func newServer(logger log.Logger, dir string, f faults) (*server, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %w", err)
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return nil, fmt.Errorf("error rate must be within [0, 1], got %g", f.ErrorRate)
+	}
+	if f.ErrorStatus == 0 {
+		f.ErrorStatus = http.StatusServiceUnavailable
+	}
+	return &server{logger: logger, dir: dir, faults: f, streams: map[string]stream{}}, nil
+}
+
+type response struct {
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Resync asks the agent for a full snapshot.
+	Resync bool `json:"resync,omitempty"`
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.faults.Latency > 0 {
+		select {
+		case <-time.After(s.faults.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.reply(w, http.StatusMethodNotAllowed, response{Status: "error", Error: "only POST is supported"})
+		return
+	}
+	if s.faults.ErrorRate > 0 && rand.Float64() < s.faults.ErrorRate {
+		level.Info(s.logger).Log("msg", "injecting failure", "status", s.faults.ErrorStatus)
+		s.reply(w, s.faults.ErrorStatus, response{Status: "error", Error: "injected failure"})
+		return
+	}
+
+	wire := &countingReader{r: r.Body}
+	decoded, err := decodeBody(wire, r.Header.Get("Content-Encoding"))
+	if err != nil {
+		s.reply(w, http.StatusUnsupportedMediaType, response{Status: "error", Error: err.Error()})
+		return
+	}
+	defer decoded.Close()
+	body, err := io.ReadAll(io.LimitReader(decoded, maxPayloadBytes+1))
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, response{Status: "error", Error: err.Error()})
+		return
+	}
+	if len(body) > maxPayloadBytes {
+		s.reply(w, http.StatusRequestEntityTooLarge, response{Status: "error", Error: "payload too large"})
+		return
+	}
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	seq, payload, err := s.resolve(client, body)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "requesting a resync", "remote", r.RemoteAddr, "err", err)
+		s.reply(w, http.StatusConflict, response{Status: "error", Error: err.Error(), Resync: true})
+		return
+	}
+	if _, err := validatePayload(payload); err != nil {
+		level.Warn(s.logger).Log("msg", "rejected payload", "remote", r.RemoteAddr, "err", err)
+		s.reply(w, http.StatusBadRequest, response{Status: "error", Error: err.Error()})
+		return
+	}
+
+	id, err := s.store(payload)
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to store payload", "err", err)
+		s.reply(w, http.StatusInternalServerError, response{Status: "error", Error: err.Error()})
+		return
+	}
+	if seq != nil {
+		s.streams[client] = stream{seq: seq.Seq, payload: payload}
+	}
+	level.Info(s.logger).Log("msg", "stored payload", "id", id, "bytes", len(payload), "wire_bytes", wire.n, "remote", r.RemoteAddr)
+	s.reply(w, http.StatusOK, response{Status: "ok", ID: id})
+}
+
+// resolve returns the payload body stands for, along with its sequence
+// number when it was pushed in delta mode: body itself, without its
+// "sequence", for a full snapshot, or the last payload of client patched. A
+// patch that does not apply to the last payload is an error, for which a
+// full snapshot is requested.
+func (s *server) resolve(client string, body []byte) (*push.Sequence, []byte, error) {
+	var msg struct {
+		Sequence *push.Sequence `json:"sequence"`
+		Patch    []push.Op      `json:"patch"`
+	}
+	if json.Unmarshal(body, &msg) != nil || msg.Sequence == nil {
+		// Not in delta mode, or not JSON, which validation reports.
+		return nil, body, nil
+	}
+	if msg.Sequence.Full {
+		var sections map[string]json.RawMessage
+		if err := json.Unmarshal(body, &sections); err != nil {
+			return nil, nil, err
+		}
+		delete(sections, "sequence")
+		payload, err := json.Marshal(sections)
+		return msg.Sequence, payload, err
+	}
+
+	last, ok := s.streams[client]
+	if !ok {
+		return nil, nil, fmt.Errorf("patch %d without a previous payload", msg.Sequence.Seq)
+	}
+	if last.seq != msg.Sequence.Base {
+		return nil, nil, fmt.Errorf("patch %d applies to payload %d, the last one is %d", msg.Sequence.Seq, msg.Sequence.Base, last.seq)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(last.payload, &doc); err != nil {
+		return nil, nil, err
+	}
+	doc, err := push.Apply(doc, msg.Patch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("patch %d does not apply: %w", msg.Sequence.Seq, err)
+	}
+	payload, err := json.Marshal(doc)
+	return msg.Sequence, payload, err
+}
+
+// decodeBody returns a reader of the body decoded according to its
+// Content-Encoding.
+func decodeBody(body io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "zstd":
+		d, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *server) reply(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// store writes the payload to a new file named after the arrival time and
+// a sequence number, so lexical order matches arrival order.
+func (s *server) store(body []byte) (string, error) {
+	id := fmt.Sprintf("%d-%06d", time.Now().UnixNano(), s.seq.Add(1))
+	tmp := filepath.Join(s.dir, "."+id+".tmp")
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, id+".json")); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return id, nil
+}
+
+// validatePayload checks that body is a JSON object carrying every
+// required section and that the sections described by
+// handle.CollectDataStruct decode into it without unknown fields. Sections
+// added by other handle modules are accepted as they are.
+func validatePayload(body []byte) (*handle.CollectDataStruct, error) {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(body, &sections); err != nil {
+		return nil, fmt.Errorf("payload is not a JSON object: %w", err)
+	}
+	for _, name := range handle.RequiredSections {
+		if _, ok := sections[name]; !ok {
+			return nil, fmt.Errorf("missing section %q", name)
+		}
+	}
+
+	known := make(map[string]json.RawMessage)
+	for _, name := range knownSections() {
+		if section, ok := sections[name]; ok {
+			known[name] = section
+		}
+	}
+	knownBody, err := json.Marshal(known)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(knownBody))
+	dec.DisallowUnknownFields()
+	var data handle.CollectDataStruct
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("payload does not match schema: %w", err)
+	}
+	return &data, nil
+}
+
+// knownSections returns the JSON names of the handle.CollectDataStruct fields.
+func knownSections() []string {
+	t := reflect.TypeOf(handle.CollectDataStruct{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
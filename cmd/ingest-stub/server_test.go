@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/klauspost/compress/zstd"
+)
+
+const validPayload = `{
+	"memory": {"total": 1024, "free": 512},
+	"cpus": {"usage": [{"cpu": "0", "value": 0.1, "sensor": ""}], "temperature": []},
+	"disks": null,
+	"network": {"eth0": {"receive": 1, "transmit": 2}},
+	"status": [{"kind": "command", "name": "smartctl --json=c --scan", "success": false, "duration_seconds": 0.01, "error": "not found"}]
+}`
+
+func storedPayloads(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// encode compresses body as the agent does for the encoding.
+func encode(t *testing.T, body, encoding string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		return []byte(body)
+	}
+	if _, err := io.WriteString(w, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		encoding string
+		faults   faults
+		code     int
+		stored   int
+	}{
+		{name: "valid", method: http.MethodPost, body: validPayload, code: http.StatusOK, stored: 1},
+		{name: "wrong method", method: http.MethodGet, code: http.StatusMethodNotAllowed},
+		{name: "not json", method: http.MethodPost, body: "metrics", code: http.StatusBadRequest},
+		{name: "missing section", method: http.MethodPost, body: `{"memory": {}, "cpus": {}, "disks": []}`, code: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, body: `{"memory": {"used": 1}, "cpus": {}, "disks": [], "network": {}}`, code: http.StatusBadRequest},
+		{name: "extra section", method: http.MethodPost, body: `{"memory": {}, "cpus": {}, "disks": [], "network": {}, "extra": {"anything": 1}}`, code: http.StatusOK, stored: 1},
+		{name: "wrong type", method: http.MethodPost, body: `{"memory": {"total": "1"}, "cpus": {}, "disks": [], "network": {}}`, code: http.StatusBadRequest},
+		{name: "gzip", method: http.MethodPost, body: validPayload, encoding: "gzip", code: http.StatusOK, stored: 1},
+		{name: "zstd", method: http.MethodPost, body: validPayload, encoding: "zstd", code: http.StatusOK, stored: 1},
+		{name: "unsupported encoding", method: http.MethodPost, body: validPayload, encoding: "br", code: http.StatusUnsupportedMediaType},
+		{name: "injected failure", method: http.MethodPost, body: validPayload, faults: faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway}, code: http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := newServer(log.NewNopLogger(), dir, test.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(test.method, "/report/sys-collect", bytes.NewReader(encode(t, test.body, test.encoding)))
+			if test.encoding != "" {
+				req.Header.Set("Content-Encoding", test.encoding)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			if rec.Code != test.code {
+				t.Errorf("expected status %d, got %d: %s", test.code, rec.Code, rec.Body.String())
+			}
+			if got := len(storedPayloads(t, dir)); got != test.stored {
+				t.Errorf("expected %d stored payloads, got %d", test.stored, got)
+			}
+		})
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	s, err := newServer(log.NewNopLogger(), t.TempDir(), faults{Latency: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(validPayload)))
+	if elapsed := time.Since(begin); elapsed < 50*time.Millisecond {
+		t.Errorf("expected at least 50ms latency, got %s", elapsed)
+	}
+}
+
+func TestNewServerRejectsBadErrorRate(t *testing.T) {
+	if _, err := newServer(log.NewNopLogger(), t.TempDir(), faults{ErrorRate: 1.5}); err == nil {
+		t.Error("expected error for error rate above 1")
+	}
+}
+
+// TestAgentPushesToStub builds the agent and runs a single collection
+// against the stub, checking that exactly one valid payload arrives.
+func TestAgentPushesToStub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+
+	workDir := t.TempDir()
+	agent := filepath.Join(workDir, "node_exporter")
+	build := exec.Command("go", "build", "-o", agent, "go_collector")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build agent: %v\n%s", err, out)
+	}
+
+	tests := []struct {
+		name   string
+		faults faults
+		stored int
+	}{
+		{name: "accepted", stored: 1},
+		{name: "server error", faults: faults{ErrorRate: 1}, stored: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storageDir := t.TempDir()
+			s, err := newServer(log.NewNopLogger(), storageDir, test.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, agent)
+			cmd.Dir = workDir
+			cmd.Env = append(os.Environ(), "HOST="+ts.URL+"/report/sys-collect")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("agent failed: %v\n%s", err, out)
+			}
+
+			files := storedPayloads(t, storageDir)
+			if len(files) != test.stored {
+				t.Fatalf("expected %d stored payloads, got %d", test.stored, len(files))
+			}
+			for _, f := range files {
+				body, err := os.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := validatePayload(body); err != nil {
+					t.Errorf("stored payload %s is invalid: %v", f, err)
+				}
+			}
+		})
+	}
+}
+
+func TestServerDelta(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newServer(log.NewNopLogger(), dir, faults{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := strings.Replace(validPayload, "{", `{"sequence": {"seq": 1, "full": true},`, 1)
+	steps := []struct {
+		name   string
+		body   string
+		code   int
+		stored int
+	}{
+		{name: "patch before a snapshot", body: `{"sequence": {"seq": 1, "base": 0}, "patch": []}`, code: http.StatusConflict},
+		{name: "snapshot", body: full, code: http.StatusOK, stored: 1},
+		{name: "patch", body: `{"sequence": {"seq": 2, "base": 1}, "patch": [{"op": "replace", "path": "/memory/free", "value": 256}]}`, code: http.StatusOK, stored: 2},
+		{name: "gap", body: `{"sequence": {"seq": 4, "base": 3}, "patch": []}`, code: http.StatusConflict, stored: 2},
+		{name: "patch not applying", body: `{"sequence": {"seq": 3, "base": 2}, "patch": [{"op": "replace", "path": "/load", "value": 1}]}`, code: http.StatusConflict, stored: 2},
+		{name: "patch breaking the schema", body: `{"sequence": {"seq": 3, "base": 2}, "patch": [{"op": "remove", "path": "/memory"}]}`, code: http.StatusBadRequest, stored: 2},
+		{name: "next patch", body: `{"sequence": {"seq": 3, "base": 2}, "patch": [{"op": "add", "path": "/network/eth1", "value": {"receive": 3, "transmit": 4}}]}`, code: http.StatusOK, stored: 3},
+	}
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/report/sys-collect", strings.NewReader(step.body)))
+		if rec.Code != step.code {
+			t.Errorf("%s: expected status %d, got %d: %s", step.name, step.code, rec.Code, rec.Body.String())
+		}
+		if step.code == http.StatusConflict && !strings.Contains(rec.Body.String(), `"resync":true`) {
+			t.Errorf("%s: expected a resync request, got %s", step.name, rec.Body.String())
+		}
+		if got := len(storedPayloads(t, dir)); got != step.stored {
+			t.Errorf("%s: expected %d stored payloads, got %d", step.name, step.stored, got)
+		}
+	}
+
+	files := storedPayloads(t, dir)
+	last, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := validatePayload(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Memory.Free != 256 || data.Network["eth1"] == nil || data.Network["eth0"] == nil {
+		t.Errorf("expected both patches applied to the snapshot, got %s", last)
+	}
+	if strings.Contains(string(last), "sequence") {
+		t.Errorf("expected the sequence to be left out of stored payloads, got %s", last)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "sort"
+
+// captureGlobs are the files read by the collectors, in the snapshot layout
+// of UseFixtures. Matching directories are captured recursively. Collectors
+// reading nothing from proc, sys or udev have an empty entry.
+var captureGlobs = map[string][]string{
+	"certfile":     {},
+	"cgroupv2":     {"sys/fs/cgroup"},
+	"conntrack":    {"proc/sys/net/netfilter/nf_conntrack_*"},
+	"cpu":          {"proc/stat", "proc/cpuinfo", "sys/devices/system/cpu"},
+	"cpufreq":      {"sys/devices/system/cpu"},
+	"diskstats":    {"proc/diskstats", "udev/data/b*"},
+	"entropy":      {"proc/sys/kernel/random"},
+	"filefd":       {"proc/sys/fs/file-nr"},
+	"filesystem":   {"proc/1/mountinfo"},
+	"hwmon":        {"sys/class/hwmon/*"},
+	"interrupts":   {"proc/interrupts"},
+	"kmsg":         {},
+	"loadavg":      {"proc/loadavg"},
+	"logwatch":     {},
+	"meminfo":      {"proc/meminfo"},
+	"netclass":     {"sys/class/net/*"},
+	"netdev":       {"proc/net/dev"},
+	"netstat":      {"proc/net/netstat", "proc/net/snmp", "proc/net/snmp6"},
+	"nvme":         {"sys/class/nvme/*"},
+	"pressure":     {"proc/pressure"},
+	"probe":        {},
+	"process":      {"proc/[0-9]*/stat", "proc/[0-9]*/cmdline", "proc/[0-9]*/fd", "proc/[0-9]*/io"},
+	"processes":    {"proc/sys/kernel/threads-max", "proc/sys/kernel/pid_max", "proc/[0-9]*/stat", "proc/[0-9]*/task/[0-9]*/stat"},
+	"schedstat":    {"proc/schedstat"},
+	"script":       {},
+	"sockets":      {},
+	"sockstat":     {"proc/net/sockstat", "proc/net/sockstat6"},
+	"softirqs":     {"proc/softirqs"},
+	"softnet":      {"proc/net/softnet_stat"},
+	"stat":         {"proc/stat"},
+	"systemd":      {},
+	"tcpstat":      {},
+	"textfile":     {},
+	"thermal_zone": {"sys/class/thermal/*"},
+	"time":         {},
+	"uname":        {},
+	"vmstat":       {"proc/vmstat"},
+}
+
+// CaptureGlobs returns the globs of the files read by the collectors, in the
+// snapshot layout of UseFixtures: proc/, sys/ and udev/data/. unknown lists
+// the collectors the files of which are not known.
+func CaptureGlobs(collectors []string) (globs, unknown []string) {
+	seen := map[string]bool{}
+	for _, name := range collectors {
+		g, ok := captureGlobs[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		for _, glob := range g {
+			if !seen[glob] {
+				seen[glob] = true
+				globs = append(globs, glob)
+			}
+		}
+	}
+	sort.Strings(globs)
+	sort.Strings(unknown)
+	return globs, unknown
+}
+
+// CaptureRoots returns where the top directories of the snapshot layout
+// are on the host, following --path.procfs, --path.sysfs and
+// --path.udev.data.
+func CaptureRoots() map[string]string {
+	return map[string]string{"proc": *procPath, "sys": *sysPath, "udev/data": *udevDataPath}
+}
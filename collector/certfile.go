@@ -0,0 +1,211 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocertfile
+// +build !nocertfile
+
+package collector
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const certfileSubsystem = "certfile"
+
+var (
+	certfileGlobs            = kingpin.Flag("collector.certfile.path", "Glob of certificate files (PEM, DER or PKCS#12) to report. May be repeated.").Strings()
+	certfileKeystorePassword = kingpin.Flag("collector.certfile.keystore-password", "Password of the PKCS#12 keystores.").Default("").String()
+)
+
+type certfileCollector struct {
+	globs    []string
+	password string
+	now      func() time.Time
+
+	notAfter      *prometheus.Desc
+	daysRemaining *prometheus.Desc
+	fileError     *prometheus.Desc
+	logger        log.Logger
+}
+
+func init() {
+	registerCollector("certfile", defaultDisabled, NewCertfileCollector)
+}
+
+// NewCertfileCollector returns a new Collector exposing the expiry of the
+// certificates in the files matching --collector.certfile.path.
+func NewCertfileCollector(logger log.Logger) (Collector, error) {
+	return newCertfileCollector(*certfileGlobs, *certfileKeystorePassword, logger), nil
+}
+
+func newCertfileCollector(globs []string, password string, logger log.Logger) *certfileCollector {
+	labels := []string{"file", "serial", "subject", "issuer", "dns_names"}
+	return &certfileCollector{
+		globs:    globs,
+		password: password,
+		now:      time.Now,
+		notAfter: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, certfileSubsystem, "not_after_seconds"),
+			"Expiry time of the certificate since unix epoch in seconds.",
+			labels, nil,
+		),
+		daysRemaining: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, certfileSubsystem, "days_remaining"),
+			"Days left until the certificate expires, negative once expired.",
+			labels, nil,
+		),
+		fileError: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, certfileSubsystem, "file_error"),
+			"Whether the file could not be read or contained no certificate.",
+			[]string{"file"}, nil,
+		),
+		logger: logger,
+	}
+}
+
+// Update implements the Collector interface.
+func (c *certfileCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.globs) == 0 {
+		return ErrNoData
+	}
+
+	var files []string
+	for _, glob := range c.globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return fmt.Errorf("invalid certificate glob %q: %w", glob, err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	now := c.now()
+	seen := map[string]bool{}
+	for _, file := range files {
+		// File names are bytes; names that differ only in bytes that are
+		// not UTF-8 are reported once.
+		name := strings.ToValidUTF8(file, "\uFFFD")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		certs, err := c.readCertificates(file)
+		fileError := 0.0
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "failed to read certificates", "file", file, "err", err)
+			fileError = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.fileError, prometheus.GaugeValue, fileError, name)
+
+		// Bundles may list a certificate more than once; report it once.
+		certSeen := map[string]bool{}
+		for _, cert := range certs {
+			// Names such as T61String ones are not checked to be UTF-8.
+			labels := []string{
+				name,
+				cert.SerialNumber.Text(16),
+				strings.ToValidUTF8(cert.Subject.String(), "\uFFFD"),
+				strings.ToValidUTF8(cert.Issuer.String(), "\uFFFD"),
+				strings.ToValidUTF8(strings.Join(cert.DNSNames, ","), "\uFFFD"),
+			}
+			key := strings.Join(labels, "\x00")
+			if certSeen[key] {
+				continue
+			}
+			certSeen[key] = true
+			ch <- prometheus.MustNewConstMetric(c.notAfter, prometheus.GaugeValue, float64(cert.NotAfter.Unix()), labels...)
+			ch <- prometheus.MustNewConstMetric(c.daysRemaining, prometheus.GaugeValue, cert.NotAfter.Sub(now).Hours()/24, labels...)
+		}
+	}
+	return nil
+}
+
+// readCertificates returns the certificates in a PEM file, a DER file or a
+// PKCS#12 keystore. Private keys and other PEM blocks are skipped.
+func (c *certfileCollector) readCertificates(file string) ([]*x509.Certificate, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New("is a directory")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		certs, err = parsePEMCertificates(data)
+	case strings.HasSuffix(file, ".p12"), strings.HasSuffix(file, ".pfx"):
+		var blocks []*pem.Block
+		if blocks, err = pkcs12.ToPEM(data, c.password); err == nil {
+			for _, block := range blocks {
+				if block.Type != "CERTIFICATE" {
+					continue
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			}
+		}
+	default:
+		certs, err = x509.ParseCertificates(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certs, nil
+}
+
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
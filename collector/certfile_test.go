@@ -0,0 +1,113 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocertfile
+// +build !nocertfile
+
+package collector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestCertificate returns a self-signed DER certificate and its PEM
+// encoded private key.
+func newTestCertificate(t *testing.T, serial int64, name string, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "www." + name},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestCertfileCollector(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	web, webKey := newTestCertificate(t, 10, "example.com", now.AddDate(0, 0, 30))
+	expired, _ := newTestCertificate(t, 11, "old.example.com", now.AddDate(0, 0, -2))
+	// The key is skipped, the certificate listed twice reported once. A file
+	// name that is not UTF-8 is reported with a replacement character.
+	webPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: web})
+	bundle := append(append(webKey, webPEM...), webPEM...)
+	files := map[string][]byte{
+		"web.pem":     bundle,
+		"old.der":     expired,
+		"key.pem":     webKey,
+		"garbage.crt": []byte("not a certificate"),
+		"\xffweb.pem": webPEM,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newCertfileCollector([]string{filepath.Join(dir, "*.pem"), filepath.Join(dir, "*.der"), filepath.Join(dir, "*.crt")}, "", log.NewNopLogger())
+	c.now = func() time.Time { return now }
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+
+	want := `# HELP node_certfile_days_remaining Days left until the certificate expires, negative once expired.
+# TYPE node_certfile_days_remaining gauge
+node_certfile_days_remaining{dns_names="example.com,www.example.com",file="DIR/web.pem",issuer="CN=example.com",serial="a",subject="CN=example.com"} 30
+node_certfile_days_remaining{dns_names="example.com,www.example.com",file="DIR/�web.pem",issuer="CN=example.com",serial="a",subject="CN=example.com"} 30
+node_certfile_days_remaining{dns_names="old.example.com,www.old.example.com",file="DIR/old.der",issuer="CN=old.example.com",serial="b",subject="CN=old.example.com"} -2
+# HELP node_certfile_file_error Whether the file could not be read or contained no certificate.
+# TYPE node_certfile_file_error gauge
+node_certfile_file_error{file="DIR/garbage.crt"} 1
+node_certfile_file_error{file="DIR/key.pem"} 1
+node_certfile_file_error{file="DIR/old.der"} 0
+node_certfile_file_error{file="DIR/web.pem"} 0
+node_certfile_file_error{file="DIR/�web.pem"} 0
+# HELP node_certfile_not_after_seconds Expiry time of the certificate since unix epoch in seconds.
+# TYPE node_certfile_not_after_seconds gauge
+node_certfile_not_after_seconds{dns_names="example.com,www.example.com",file="DIR/web.pem",issuer="CN=example.com",serial="a",subject="CN=example.com"} 1.7066592e+09
+node_certfile_not_after_seconds{dns_names="example.com,www.example.com",file="DIR/�web.pem",issuer="CN=example.com",serial="a",subject="CN=example.com"} 1.7066592e+09
+node_certfile_not_after_seconds{dns_names="old.example.com,www.old.example.com",file="DIR/old.der",issuer="CN=old.example.com",serial="b",subject="CN=old.example.com"} 1.7038944e+09
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(strings.ReplaceAll(want, "DIR", dir))); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocgroupv2
+// +build !nocgroupv2
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const cgroupSubsystem = "cgroup"
+
+var (
+	cgroupDepth = kingpin.Flag("collector.cgroupv2.depth", "Depth below the root of the cgroup v2 hierarchy down to which cgroups are reported.").Default("2").Int()
+	cgroupNames = kingpin.Flag("collector.cgroupv2.name", "Report cgroups whose path matches REGEXP with the name label NAME. May be repeated.").PlaceHolder("NAME=REGEXP").StringMap()
+)
+
+// cgroupContainerScope matches the scopes container runtimes create for
+// their containers, e.g. "docker-<id>.scope".
+var cgroupContainerScope = regexp.MustCompile(`^(docker|cri-containerd|crio|libpod)-([0-9a-f]{12,})\.scope$`)
+
+// cgroupName is a name given to the cgroups whose path matches pattern.
+type cgroupName struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type cgroupV2Collector struct {
+	root  string
+	depth int
+	names []cgroupName
+
+	cpuUsage         *prometheus.Desc
+	cpuUser          *prometheus.Desc
+	cpuSystem        *prometheus.Desc
+	cpuPeriods       *prometheus.Desc
+	cpuThrottled     *prometheus.Desc
+	cpuThrottledTime *prometheus.Desc
+	memoryCurrent    *prometheus.Desc
+	memoryMax        *prometheus.Desc
+	memoryEvents     *prometheus.Desc
+	ioReadBytes      *prometheus.Desc
+	ioWriteBytes     *prometheus.Desc
+	ioReads          *prometheus.Desc
+	ioWrites         *prometheus.Desc
+	pressureStalled  *prometheus.Desc
+	logger           log.Logger
+}
+
+func init() {
+	registerCollector("cgroupv2", defaultDisabled, NewCgroupV2Collector)
+}
+
+// NewCgroupV2Collector returns a new Collector exposing the resource usage of
+// the cgroups in the cgroup v2 unified hierarchy.
+func NewCgroupV2Collector(logger log.Logger) (Collector, error) {
+	names, err := parseCgroupNames(*cgroupNames)
+	if err != nil {
+		return nil, err
+	}
+	return newCgroupV2Collector(sysFilePath("fs/cgroup"), *cgroupDepth, names, logger), nil
+}
+
+func parseCgroupNames(names map[string]string) ([]cgroupName, error) {
+	result := make([]cgroupName, 0, len(names))
+	for name, pattern := range names {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for cgroup name %s: %w", name, err)
+		}
+		result = append(result, cgroupName{name: name, pattern: re})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, nil
+}
+
+func newCgroupV2Collector(root string, depth int, names []cgroupName, logger log.Logger) *cgroupV2Collector {
+	labels := []string{"cgroup", "name"}
+	desc := func(name, help string, extra ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, cgroupSubsystem, name), help, append(labels, extra...), nil)
+	}
+	return &cgroupV2Collector{
+		root:             root,
+		depth:            depth,
+		names:            names,
+		cpuUsage:         desc("cpu_usage_seconds_total", "Total CPU time consumed."),
+		cpuUser:          desc("cpu_user_seconds_total", "CPU time consumed in user mode."),
+		cpuSystem:        desc("cpu_system_seconds_total", "CPU time consumed in system mode."),
+		cpuPeriods:       desc("cpu_periods_total", "Number of enforcement periods elapsed."),
+		cpuThrottled:     desc("cpu_throttled_periods_total", "Number of enforcement periods in which the cgroup was throttled."),
+		cpuThrottledTime: desc("cpu_throttled_seconds_total", "Total time the cgroup was throttled."),
+		memoryCurrent:    desc("memory_current_bytes", "Memory currently used by the cgroup and its descendants."),
+		memoryMax:        desc("memory_max_bytes", "Memory usage hard limit, unset when unlimited."),
+		memoryEvents:     desc("memory_events_total", "Number of memory events, from memory.events.", "event"),
+		ioReadBytes:      desc("io_read_bytes_total", "Bytes read from the device.", "device"),
+		ioWriteBytes:     desc("io_write_bytes_total", "Bytes written to the device.", "device"),
+		ioReads:          desc("io_reads_total", "Read operations issued to the device.", "device"),
+		ioWrites:         desc("io_writes_total", "Write operations issued to the device.", "device"),
+		pressureStalled:  desc("pressure_stalled_seconds_total", "Total time tasks were stalled on the resource, from the PSI files.", "resource", "kind"),
+		logger:           logger,
+	}
+}
+
+// Update implements the Collector interface.
+func (c *cgroupV2Collector) Update(ch chan<- prometheus.Metric) error {
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "cgroup v2 unified hierarchy not mounted", "path", c.root)
+			return ErrNoData
+		}
+		return err
+	}
+
+	return filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The cgroup may have been removed while walking.
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		depth := 0
+		if rel != "." {
+			depth = strings.Count(rel, string(filepath.Separator)) + 1
+		}
+		if depth > c.depth {
+			return filepath.SkipDir
+		}
+		cgroup := "/"
+		if rel != "." {
+			cgroup += filepath.ToSlash(rel)
+		}
+		c.updateCgroup(ch, path, cgroup)
+		return nil
+	})
+}
+
+// name returns the name label of the cgroup: the configured name matching
+// its path, the runtime and short ID of a container scope, or the last path
+// element.
+func (c *cgroupV2Collector) name(cgroup string) string {
+	for _, n := range c.names {
+		if n.pattern.MatchString(cgroup) {
+			return n.name
+		}
+	}
+	if cgroup == "/" {
+		return "root"
+	}
+	base := filepath.Base(cgroup)
+	if m := cgroupContainerScope.FindStringSubmatch(base); m != nil {
+		return m[1] + "/" + m[2][:12]
+	}
+	return base
+}
+
+func (c *cgroupV2Collector) updateCgroup(ch chan<- prometheus.Metric, dir, cgroup string) {
+	labels := []string{cgroup, c.name(cgroup)}
+	read := func(file string, parse func(*bufio.Scanner) error) {
+		f, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			// Files are missing for controllers not enabled in the cgroup.
+			if !errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "failed to open cgroup file", "cgroup", cgroup, "file", file, "err", err)
+			}
+			return
+		}
+		defer f.Close()
+		if err := parse(bufio.NewScanner(f)); err != nil {
+			level.Debug(c.logger).Log("msg", "failed to parse cgroup file", "cgroup", cgroup, "file", file, "err", err)
+		}
+	}
+
+	read("cpu.stat", func(s *bufio.Scanner) error {
+		stat, err := parseCgroupKeyValues(s)
+		if err != nil {
+			return err
+		}
+		for key, desc := range map[string]*prometheus.Desc{
+			"usage_usec":     c.cpuUsage,
+			"user_usec":      c.cpuUser,
+			"system_usec":    c.cpuSystem,
+			"throttled_usec": c.cpuThrottledTime,
+		} {
+			if v, ok := stat[key]; ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v/1e6, labels...)
+			}
+		}
+		if v, ok := stat["nr_periods"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuPeriods, prometheus.CounterValue, v, labels...)
+		}
+		if v, ok := stat["nr_throttled"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuThrottled, prometheus.CounterValue, v, labels...)
+		}
+		return nil
+	})
+
+	read("memory.current", func(s *bufio.Scanner) error {
+		v, err := parseCgroupValue(s)
+		if err == nil {
+			ch <- prometheus.MustNewConstMetric(c.memoryCurrent, prometheus.GaugeValue, v, labels...)
+		}
+		return err
+	})
+	read("memory.max", func(s *bufio.Scanner) error {
+		v, err := parseCgroupValue(s)
+		if errors.Is(err, errCgroupUnlimited) {
+			return nil
+		}
+		if err == nil {
+			ch <- prometheus.MustNewConstMetric(c.memoryMax, prometheus.GaugeValue, v, labels...)
+		}
+		return err
+	})
+	read("memory.events", func(s *bufio.Scanner) error {
+		events, err := parseCgroupKeyValues(s)
+		if err != nil {
+			return err
+		}
+		for event, v := range events {
+			ch <- prometheus.MustNewConstMetric(c.memoryEvents, prometheus.CounterValue, v, append(labels, event)...)
+		}
+		return nil
+	})
+
+	read("io.stat", func(s *bufio.Scanner) error {
+		for s.Scan() {
+			fields := strings.Fields(s.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			device := fields[0]
+			for _, field := range fields[1:] {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					return fmt.Errorf("malformed io.stat field %q", field)
+				}
+				var desc *prometheus.Desc
+				switch key {
+				case "rbytes":
+					desc = c.ioReadBytes
+				case "wbytes":
+					desc = c.ioWriteBytes
+				case "rios":
+					desc = c.ioReads
+				case "wios":
+					desc = c.ioWrites
+				default:
+					continue
+				}
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return err
+				}
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, append(labels, device)...)
+			}
+		}
+		return s.Err()
+	})
+
+	for _, resource := range []string{"cpu", "io", "memory"} {
+		resource := resource
+		read(resource+".pressure", func(s *bufio.Scanner) error {
+			for s.Scan() {
+				fields := strings.Fields(s.Text())
+				if len(fields) == 0 {
+					continue
+				}
+				for _, field := range fields[1:] {
+					value, ok := strings.CutPrefix(field, "total=")
+					if !ok {
+						continue
+					}
+					v, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						return err
+					}
+					ch <- prometheus.MustNewConstMetric(c.pressureStalled, prometheus.CounterValue, v/1e6, append(labels, resource, fields[0])...)
+				}
+			}
+			return s.Err()
+		})
+	}
+}
+
+var errCgroupUnlimited = errors.New("unlimited")
+
+// parseCgroupValue parses a single value file such as memory.current,
+// returning errCgroupUnlimited for "max".
+func parseCgroupValue(s *bufio.Scanner) (float64, error) {
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("empty file")
+	}
+	value := strings.TrimSpace(s.Text())
+	if value == "max" {
+		return 0, errCgroupUnlimited
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseCgroupKeyValues parses a flat keyed file such as cpu.stat.
+func parseCgroupKeyValues(s *bufio.Scanner) (map[string]float64, error) {
+	values := map[string]float64{}
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line %q", s.Text())
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		values[fields[0]] = v
+	}
+	return values, s.Err()
+}
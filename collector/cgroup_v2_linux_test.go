@@ -0,0 +1,54 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocgroupv2
+// +build !nocgroupv2
+
+package collector
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCgroupV2Collector(t *testing.T) {
+	names, err := parseCgroupNames(map[string]string{"sessions": "^/user.slice/.+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCgroupV2Collector("fixtures/sys/fs/cgroup", 2, names, log.NewNopLogger())
+
+	want, err := os.ReadFile("fixtures/cgroupv2.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(string(want))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCgroupV2CollectorNotMounted(t *testing.T) {
+	c := newCgroupV2Collector(t.TempDir(), 2, nil, log.NewNopLogger())
+	ch := make(chan prometheus.Metric, 1)
+	if err := c.Update(ch); !errors.Is(err, ErrNoData) {
+		t.Fatalf("expected ErrNoData, got %v", err)
+	}
+}
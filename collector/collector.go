@@ -15,8 +15,10 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -42,6 +44,27 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_timeout"),
+		"node_exporter: Whether a collector was abandoned because it exceeded its timeout.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+var (
+	scrapeTimeout = kingpin.Flag(
+		"scrape.timeout",
+		"Maximum duration of a whole collection run, 0 disables the limit.",
+	).Default("0s").Duration()
+	collectorTimeout = kingpin.Flag(
+		"collector.timeout",
+		"Default maximum duration of a single collector, 0 disables the limit.",
+	).Default("0s").Duration()
+	collectorTimeoutOverrides = kingpin.Flag(
+		"collector.timeout.override",
+		"Maximum duration of the named collector, overriding --collector.timeout. May be repeated.",
+	).PlaceHolder("NAME=DURATION").StringMap()
 )
 
 const (
@@ -75,10 +98,42 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 	factories[collector] = factory
 }
 
+// Registered reports whether a collector named name exists.
+func Registered(name string) bool {
+	_, ok := factories[name]
+	return ok
+}
+
 // NodeCollector implements the prometheus.Collector interface.
 type NodeCollector struct {
 	Collectors map[string]Collector
 	logger     log.Logger
+	timeout    time.Duration
+	timeouts   map[string]time.Duration
+	status     *scrapeStatus
+}
+
+// CollectorStatus is the outcome of a collector's most recent Update.
+type CollectorStatus struct {
+	Name     string
+	Success  bool
+	TimedOut bool
+	Duration time.Duration
+	Err      error
+}
+
+type scrapeStatus struct {
+	mtx    sync.Mutex
+	byName map[string]CollectorStatus
+}
+
+func (s *scrapeStatus) set(cs CollectorStatus) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	s.byName[cs.Name] = cs
+	s.mtx.Unlock()
 }
 
 // DisableDefaultCollectors sets the collector state to false for all collectors which
@@ -134,36 +189,100 @@ func NewNodeCollector(logger log.Logger, filters ...string) (*NodeCollector, err
 			initiatedCollectors[key] = collector
 		}
 	}
-	return &NodeCollector{Collectors: collectors, logger: logger}, nil
+	timeouts, err := parseCollectorTimeouts(*collectorTimeoutOverrides)
+	if err != nil {
+		return nil, err
+	}
+	for name := range collectors {
+		if _, ok := timeouts[name]; !ok && *collectorTimeout > 0 {
+			timeouts[name] = *collectorTimeout
+		}
+	}
+	return &NodeCollector{
+		Collectors: collectors,
+		logger:     logger,
+		timeout:    *scrapeTimeout,
+		timeouts:   timeouts,
+		status:     &scrapeStatus{byName: make(map[string]CollectorStatus)},
+	}, nil
+}
+
+// Status returns the outcome of each collector's most recent Update, sorted
+// by collector name. Collectors that have not run yet are omitted.
+func (n NodeCollector) Status() []CollectorStatus {
+	if n.status == nil {
+		return nil
+	}
+	n.status.mtx.Lock()
+	defer n.status.mtx.Unlock()
+	result := make([]CollectorStatus, 0, len(n.status.byName))
+	for _, cs := range n.status.byName {
+		result = append(result, cs)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// parseCollectorTimeouts converts the NAME=DURATION overrides into durations.
+func parseCollectorTimeouts(overrides map[string]string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(overrides))
+	for name, value := range overrides {
+		if _, ok := factories[name]; !ok {
+			return nil, fmt.Errorf("timeout set for missing collector: %s", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for collector %s: %w", name, err)
+		}
+		timeouts[name] = d
+	}
+	return timeouts, nil
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeTimeoutDesc
 }
 
 // Collect implements the prometheus.Collector interface.
 func (n NodeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if n.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
-			wg.Done()
+			defer wg.Done()
+			ctx := ctx
+			if timeout := n.timeouts[name]; timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			n.status.set(execute(ctx, name, c, ch, n.logger))
 		}(name, c)
 	}
 	wg.Wait()
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) CollectorStatus {
 	begin := time.Now()
-	err := c.Update(ch)
+	err := updateContext(ctx, c, ch)
 	duration := time.Since(begin)
-	var success float64
+	var success, timedOut float64
 
 	if err != nil {
-		if IsNoDataError(err) {
+		if IsTimeoutError(err) {
+			level.Error(logger).Log("msg", "collector timed out", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+			timedOut = 1
+		} else if IsNoDataError(err) {
 			level.Debug(logger).Log("msg", "collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		} else {
 			level.Error(logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
@@ -175,6 +294,49 @@ func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.L
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timedOut, name)
+	return CollectorStatus{Name: name, Success: success == 1, TimedOut: timedOut == 1, Duration: duration, Err: err}
+}
+
+// updateContext runs c.Update and forwards its metrics to ch until Update
+// returns or ctx is done. Update itself cannot be interrupted, so once ctx is
+// done its remaining metrics are drained and dropped in the background; ch is
+// never written to after updateContext returns.
+func updateContext(ctx context.Context, c Collector, ch chan<- prometheus.Metric) error {
+	if ctx.Done() == nil {
+		return c.Update(ch)
+	}
+
+	proxy := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Update(proxy)
+		close(proxy)
+	}()
+
+	for {
+		select {
+		case m, ok := <-proxy:
+			if !ok {
+				return <-done
+			}
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				go drain(proxy)
+				return &timeoutError{err: ctx.Err()}
+			}
+		case <-ctx.Done():
+			go drain(proxy)
+			return &timeoutError{err: ctx.Err()}
+		}
+	}
+}
+
+// drain discards metrics until the producing collector closes ch.
+func drain(ch <-chan prometheus.Metric) {
+	for range ch {
+	}
 }
 
 // Collector is the interface a collector has to implement.
@@ -199,6 +361,26 @@ func IsNoDataError(err error) bool {
 	return err == ErrNoData
 }
 
+// timeoutError indicates a collector was abandoned because its context ended
+// before Update returned.
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("collector timed out: %v", e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// IsTimeoutError reports whether err was caused by a collector timeout.
+func IsTimeoutError(err error) bool {
+	var te *timeoutError
+	return errors.As(err, &te)
+}
+
 // pushMetric helps construct and convert a variety of value types into Prometheus float64 metrics.
 func pushMetric(ch chan<- prometheus.Metric, fieldDesc *prometheus.Desc, name string, value interface{}, valueType prometheus.ValueType, labelValues ...string) {
 	var fVal float64
@@ -0,0 +1,137 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var testDesc = prometheus.NewDesc("node_test_value", "Test metric.", []string{"collector"}, nil)
+
+// blockingCollector emits one metric and then blocks until release is closed.
+type blockingCollector struct {
+	release chan struct{}
+	done    chan struct{}
+}
+
+func (c *blockingCollector) Update(ch chan<- prometheus.Metric) error {
+	defer close(c.done)
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1, "blocking")
+	<-c.release
+	// Written after the collector was abandoned; must not reach the registry.
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 2, "blocking")
+	return nil
+}
+
+type quickCollector struct{}
+
+func (quickCollector) Update(ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 3, "quick")
+	return nil
+}
+
+func scrapeValues(mfs []*dto.MetricFamily, name string) map[string]float64 {
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == "collector" {
+					values[lp.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestCollectTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		timeouts map[string]time.Duration
+	}{
+		{name: "global", timeout: 100 * time.Millisecond},
+		{name: "per collector", timeouts: map[string]time.Duration{"blocking": 100 * time.Millisecond}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blocking := &blockingCollector{release: make(chan struct{}), done: make(chan struct{})}
+			nc := NodeCollector{
+				Collectors: map[string]Collector{"blocking": blocking, "quick": quickCollector{}},
+				logger:     log.NewNopLogger(),
+				timeout:    test.timeout,
+				timeouts:   test.timeouts,
+				status:     &scrapeStatus{byName: make(map[string]CollectorStatus)},
+			}
+			r := prometheus.NewRegistry()
+			r.MustRegister(nc)
+
+			begin := time.Now()
+			mfs, err := r.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(begin); elapsed > 5*time.Second {
+				t.Fatalf("gather took %s, expected timeout to cut it short", elapsed)
+			}
+
+			success := scrapeValues(mfs, "node_scrape_collector_success")
+			timedOut := scrapeValues(mfs, "node_scrape_collector_timeout")
+			if success["blocking"] != 0 || timedOut["blocking"] != 1 {
+				t.Errorf("expected blocking collector to time out, got success=%v timeout=%v", success["blocking"], timedOut["blocking"])
+			}
+			if success["quick"] != 1 || timedOut["quick"] != 0 {
+				t.Errorf("expected quick collector to succeed, got success=%v timeout=%v", success["quick"], timedOut["quick"])
+			}
+
+			for _, cs := range nc.Status() {
+				if cs.Name == "blocking" && (!cs.TimedOut || cs.Success || !IsTimeoutError(cs.Err)) {
+					t.Errorf("unexpected status for blocking collector: %+v", cs)
+				}
+				if cs.Name == "quick" && (!cs.Success || cs.Err != nil) {
+					t.Errorf("unexpected status for quick collector: %+v", cs)
+				}
+			}
+
+			// Releasing the abandoned collector must not panic on a closed channel.
+			close(blocking.release)
+			select {
+			case <-blocking.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("abandoned collector did not finish after release")
+			}
+		})
+	}
+}
+
+func TestParseCollectorTimeouts(t *testing.T) {
+	if _, err := parseCollectorTimeouts(map[string]string{"cpu": "2s"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := parseCollectorTimeouts(map[string]string{"cpu": "soon"}); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+	if _, err := parseCollectorTimeouts(map[string]string{"nonexistent": "2s"}); err == nil {
+		t.Error("expected error for unknown collector")
+	}
+}
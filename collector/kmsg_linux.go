@@ -0,0 +1,338 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nokmsg
+// +build !nokmsg
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	kmsgSubsystem = "kmsg"
+	// kmsgMaxRecord is the size of the buffer one record is read into; longer
+	// records fail with EINVAL.
+	kmsgMaxRecord = 8192
+)
+
+var (
+	kmsgDevice      = kingpin.Flag("collector.kmsg.device", "Kernel message device read by the kmsg collector.").Default("/dev/kmsg").String()
+	kmsgCategories  = kingpin.Flag("collector.kmsg.category", "Count kernel messages matching REGEXP as category NAME, in addition to the built-in categories. May be repeated.").PlaceHolder("NAME=REGEXP").StringMap()
+	kmsgMaxPriority = kingpin.Flag("collector.kmsg.max-priority", "Least severe syslog priority (0 emerg to 7 debug) of the categorized messages kept as recent messages.").Default("3").Int()
+	kmsgRecent      = kingpin.Flag("collector.kmsg.recent", "Number of recent critical messages kept.").Default("10").Int()
+)
+
+// kmsgDefaultCategories classify the hardware and kernel faults that are
+// only reported in the kernel log.
+var kmsgDefaultCategories = map[string]string{
+	"mce":       `(?i)machine check|mce: |hardware error`,
+	"nvme":      `nvme\S*: .*(?i:reset|timeout|I/O error)`,
+	"link_down": `(?i)link is down|link down`,
+	"oom":       `Out of memory|oom-kill|invoked oom-killer`,
+	"io_error":  `I/O error|blk_update_request|critical medium error`,
+	"fs_error":  `EXT4-fs error|XFS .*(?i:corrupt|error)|BTRFS (error|critical)`,
+	"segfault":  `segfault at`,
+}
+
+type kmsgCategory struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// kmsgMessage is a categorized kernel message.
+type kmsgMessage struct {
+	Time     float64 `json:"time"`
+	Priority int     `json:"priority"`
+	Category string  `json:"category"`
+	Message  string  `json:"message"`
+}
+
+// kmsgState is the sequence number of the next record to read during the
+// boot identified by BootID, which started at BootTime, and what was found
+// so far.
+type kmsgState struct {
+	BootID   string             `json:"boot_id"`
+	BootTime uint64             `json:"boot_time"`
+	Next     uint64             `json:"next_sequence"`
+	Counts   map[string]float64 `json:"counts"`
+	Recent   []kmsgMessage      `json:"recent"`
+}
+
+type kmsgCollector struct {
+	fs          procfs.FS
+	open        func() (io.ReadCloser, error)
+	bootID      func() (string, error)
+	categories  []kmsgCategory
+	statePath   string
+	maxPriority int
+	recent      int
+
+	messages *prometheus.Desc
+	message  *prometheus.Desc
+	logger   log.Logger
+}
+
+func init() {
+	registerCollector("kmsg", defaultDisabled, NewKmsgCollector)
+}
+
+// NewKmsgCollector returns a new Collector counting kernel messages by
+// category, read from /dev/kmsg.
+func NewKmsgCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	categories, err := parseKmsgCategories(*kmsgCategories)
+	if err != nil {
+		return nil, err
+	}
+	open := func() (io.ReadCloser, error) {
+		// Non-blocking, so that reading stops at the end of the buffer.
+		fd, err := syscall.Open(*kmsgDevice, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: *kmsgDevice, Err: err}
+		}
+		return kmsgFile(fd), nil
+	}
+	bootID := func() (string, error) {
+		id, err := os.ReadFile(procFilePath("sys/kernel/random/boot_id"))
+		return strings.TrimSpace(string(id)), err
+	}
+	return newKmsgCollector(fs, open, bootID, categories, stateFilePath("kmsg.json"), *kmsgMaxPriority, *kmsgRecent, logger), nil
+}
+
+// parseKmsgCategories returns the built-in categories, overridden and
+// extended by extra.
+func parseKmsgCategories(extra map[string]string) ([]kmsgCategory, error) {
+	patterns := map[string]string{}
+	for name, pattern := range kmsgDefaultCategories {
+		patterns[name] = pattern
+	}
+	for name, pattern := range extra {
+		patterns[name] = pattern
+	}
+	categories := make([]kmsgCategory, 0, len(patterns))
+	for name, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for kmsg category %s: %w", name, err)
+		}
+		categories = append(categories, kmsgCategory{name: name, re: re})
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].name < categories[j].name })
+	return categories, nil
+}
+
+func newKmsgCollector(fs procfs.FS, open func() (io.ReadCloser, error), bootID func() (string, error), categories []kmsgCategory, statePath string, maxPriority, recent int, logger log.Logger) *kmsgCollector {
+	return &kmsgCollector{
+		fs:          fs,
+		open:        open,
+		bootID:      bootID,
+		categories:  categories,
+		statePath:   statePath,
+		maxPriority: maxPriority,
+		recent:      recent,
+		messages: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsgSubsystem, "messages_total"),
+			"Number of kernel messages in the category since the collector first ran.",
+			[]string{"category"}, nil,
+		),
+		message: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsgSubsystem, "recent_message_info"),
+			"A recent critical kernel message. The value is the time it was logged since unix epoch in seconds.",
+			[]string{"category", "priority", "message"}, nil,
+		),
+		logger: logger,
+	}
+}
+
+// Update implements the Collector interface.
+func (c *kmsgCollector) Update(ch chan<- prometheus.Metric) error {
+	stat, err := c.fs.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't get boot time: %w", err)
+	}
+	// The boot time is derived from the uptime and may be a second off from
+	// one run to the next; the boot ID is not.
+	bootID, err := c.bootID()
+	if err != nil {
+		return fmt.Errorf("couldn't get boot ID: %w", err)
+	}
+
+	var state kmsgState
+	if err := loadState(c.statePath, &state); err != nil {
+		level.Warn(c.logger).Log("msg", "ignoring kmsg state", "err", err)
+		state = kmsgState{}
+	}
+	if state.Counts == nil {
+		state.Counts = map[string]float64{}
+	}
+	// On the first run the messages already in the buffer were logged
+	// before the collector ran: skip them. After a reboot the collector was
+	// running, so the messages of the new boot are counted.
+	first := state.BootID == "" && state.BootTime == 0
+	switch {
+	case state.BootID == "" && state.BootTime == stat.BootTime:
+		// A state saved before boot IDs were recorded.
+		state.BootID = bootID
+	case state.BootID != bootID:
+		// Sequence numbers restart at every boot.
+		state.BootID, state.BootTime, state.Next = bootID, stat.BootTime, 0
+	}
+
+	if err := c.read(&state, !first); err != nil {
+		return err
+	}
+	if err := saveState(c.statePath, state); err != nil {
+		return err
+	}
+
+	for _, category := range c.categories {
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, state.Counts[category.name], category.name)
+	}
+	seen := map[string]bool{}
+	for i := len(state.Recent) - 1; i >= 0; i-- {
+		m := state.Recent[i]
+		key := m.Category + "\x00" + m.Message
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ch <- prometheus.MustNewConstMetric(c.message, prometheus.GaugeValue, m.Time, m.Category, strconv.Itoa(m.Priority), m.Message)
+	}
+	return nil
+}
+
+// read categorizes the records from state.Next on, or only skips them
+// unless count is set. Every read of /dev/kmsg returns one record and does
+// not consume it.
+func (c *kmsgCollector) read(state *kmsgState, count bool) error {
+	f, err := c.open()
+	if err != nil {
+		return fmt.Errorf("couldn't open kernel message device: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, kmsgMaxRecord)
+	for {
+		n, err := f.Read(buf)
+		switch {
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, io.EOF):
+			return nil
+		case errors.Is(err, syscall.EPIPE):
+			// Records were overwritten since the last read; the next read
+			// returns the oldest one still in the buffer.
+			level.Debug(c.logger).Log("msg", "kernel messages were lost before they could be read")
+			continue
+		case err != nil:
+			return err
+		case n == 0:
+			return nil
+		}
+
+		priority, sequence, usec, message, err := parseKmsgRecord(string(buf[:n]))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "failed to parse kernel message", "err", err)
+			continue
+		}
+		if sequence < state.Next {
+			continue
+		}
+		state.Next = sequence + 1
+		if !count {
+			continue
+		}
+
+		for _, category := range c.categories {
+			if !category.re.MatchString(message) {
+				continue
+			}
+			state.Counts[category.name]++
+			if priority <= c.maxPriority {
+				state.Recent = append(state.Recent, kmsgMessage{
+					Time:     float64(state.BootTime) + float64(usec)/1e6,
+					Priority: priority,
+					Category: category.name,
+					Message:  message,
+				})
+				if len(state.Recent) > c.recent {
+					state.Recent = state.Recent[len(state.Recent)-c.recent:]
+				}
+			}
+			break
+		}
+	}
+}
+
+// kmsgFile reads the kernel message device with plain read calls: an
+// os.File would wait for more records instead of returning EAGAIN.
+type kmsgFile int
+
+func (f kmsgFile) Read(p []byte) (int, error) {
+	n, err := syscall.Read(int(f), p)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+func (f kmsgFile) Close() error {
+	return syscall.Close(int(f))
+}
+
+// parseKmsgRecord parses a /dev/kmsg record:
+//
+//	6,339,5140900,-;NET: Registered protocol family 10
+//	 SUBSYSTEM=net
+//
+// The priority is the syslog level, without the facility. Continuation lines
+// with device properties are dropped.
+func parseKmsgRecord(record string) (priority int, sequence, usec uint64, message string, err error) {
+	header, rest, ok := strings.Cut(record, ";")
+	if !ok {
+		return 0, 0, 0, "", fmt.Errorf("malformed kernel message %q", record)
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return 0, 0, 0, "", fmt.Errorf("malformed kernel message header %q", header)
+	}
+	prefix, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, 0, "", fmt.Errorf("invalid priority in %q: %w", header, err)
+	}
+	if sequence, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return 0, 0, 0, "", fmt.Errorf("invalid sequence number in %q: %w", header, err)
+	}
+	if usec, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return 0, 0, 0, "", fmt.Errorf("invalid timestamp in %q: %w", header, err)
+	}
+	message, _, _ = strings.Cut(rest, "\n")
+	return prefix & 7, sequence, usec, message, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nokmsg
+// +build !nokmsg
+
+package collector
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+// fakeKmsg returns one record per read, like /dev/kmsg, then EAGAIN.
+type fakeKmsg struct {
+	records []string
+}
+
+func (f *fakeKmsg) Read(p []byte) (int, error) {
+	if len(f.records) == 0 {
+		return 0, syscall.EAGAIN
+	}
+	record := f.records[0]
+	f.records = f.records[1:]
+	if record == "" {
+		return 0, syscall.EPIPE
+	}
+	return copy(p, record), nil
+}
+
+func (f *fakeKmsg) Close() error { return nil }
+
+func TestKmsgCollector(t *testing.T) {
+	fs, err := procfs.NewFS("fixtures/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories, err := parseKmsgCategories(map[string]string{"usb": "usb \\S+: device descriptor read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(t.TempDir(), "kmsg.json")
+
+	buffer := []string{
+		"6,1,1000000,-;Linux version 6.1.0\n",
+		"3,2,2000000,-;nvme nvme0: I/O 12 QID 3 timeout, reset controller\n SUBSYSTEM=nvme\n DEVICE=c241:0\n",
+		"6,3,3000000,-;e1000e 0000:00:19.0 eth0: NIC Link is Down\n",
+		"",
+		"0,4,4000000,-;mce: [Hardware Error]: CPU 2: Machine Check: 0 Bank 5: be00000000800400\n",
+	}
+	run := func(records []string, want string) {
+		t.Helper()
+		open := func() (io.ReadCloser, error) { return &fakeKmsg{records: records}, nil }
+		c := newKmsgCollector(fs, open, staticBootID("b1"), categories, statePath, 3, 10, log.NewNopLogger())
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectorAdapter{c})
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent := `# HELP node_kmsg_recent_message_info A recent critical kernel message. The value is the time it was logged since unix epoch in seconds.
+# TYPE node_kmsg_recent_message_info gauge
+node_kmsg_recent_message_info{category="mce",message="mce: [Hardware Error]: CPU 2: Machine Check: 0 Bank 5: be00000000800400",priority="0"} 1.41818328e+09
+node_kmsg_recent_message_info{category="nvme",message="nvme nvme0: I/O 12 QID 3 timeout, reset controller",priority="3"} 1.418183278e+09
+`
+	counts := func(linkDown, mce, nvme, usb int) string {
+		return `# HELP node_kmsg_messages_total Number of kernel messages in the category since the collector first ran.
+# TYPE node_kmsg_messages_total counter
+node_kmsg_messages_total{category="fs_error"} 0
+node_kmsg_messages_total{category="io_error"} 0
+node_kmsg_messages_total{category="link_down"} ` + strconv.Itoa(linkDown) + `
+node_kmsg_messages_total{category="mce"} ` + strconv.Itoa(mce) + `
+node_kmsg_messages_total{category="nvme"} ` + strconv.Itoa(nvme) + `
+node_kmsg_messages_total{category="oom"} 0
+node_kmsg_messages_total{category="segfault"} 0
+node_kmsg_messages_total{category="usb"} ` + strconv.Itoa(usb) + `
+`
+	}
+
+	// Messages logged before the first run are not counted.
+	run([]string{"3,0,500000,-;Out of memory: Killed process 1 (init)\n", buffer[0]}, counts(0, 0, 0, 0))
+	run(buffer, counts(1, 1, 1, 0)+recent)
+	// Records read by the previous run are not counted again.
+	run(append(buffer, "4,5,5000000,-;usb 1-1: device descriptor read/64, error -71\n"), counts(1, 1, 1, 1)+recent)
+}
+
+func staticBootID(id string) func() (string, error) {
+	return func() (string, error) { return id, nil }
+}
+
+func TestKmsgCollectorBoot(t *testing.T) {
+	stat, err := os.ReadFile("fixtures/proc/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(t.TempDir(), "kmsg.json")
+	categories, err := parseKmsgCategories(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(btime, bootID string, want int) {
+		t.Helper()
+		// A boot time computed from the uptime may be a second off.
+		proc := t.TempDir()
+		if err := os.WriteFile(filepath.Join(proc, "stat"), []byte(strings.Replace(string(stat), "btime 1418183276", "btime "+btime, 1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := procfs.NewFS(proc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		open := func() (io.ReadCloser, error) {
+			return &fakeKmsg{records: []string{"3,1,1000000,-;Out of memory: Killed process 42 (java)\n"}}, nil
+		}
+		c := newKmsgCollector(fs, open, staticBootID(bootID), categories, statePath, 3, 10, log.NewNopLogger())
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectorAdapter{c})
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got float64
+		for _, mf := range mfs {
+			if mf.GetName() != "node_kmsg_messages_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				if m.GetLabel()[0].GetValue() == "oom" {
+					got = m.GetCounter().GetValue()
+				}
+			}
+		}
+		if got != float64(want) {
+			t.Errorf("boot %s, btime %s: expected %d oom messages, got %v", bootID, btime, want, got)
+		}
+	}
+
+	// The record logged before the first run is not counted, nor when the
+	// boot time moves.
+	run("1418183276", "b1", 0)
+	run("1418183277", "b1", 0)
+	// Sequence numbers restart after a reboot, whose messages are counted.
+	run("1418190000", "b2", 1)
+}
+
+func TestParseKmsgRecord(t *testing.T) {
+	priority, sequence, usec, message, err := parseKmsgRecord("30,339,5140900,-;NET: Registered protocol family 10\n SUBSYSTEM=net\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priority != 6 || sequence != 339 || usec != 5140900 || message != "NET: Registered protocol family 10" {
+		t.Errorf("unexpected record: %d %d %d %q", priority, sequence, usec, message)
+	}
+	if _, _, _, _, err := parseKmsgRecord("no header"); err == nil {
+		t.Error("expected an error for a record without header")
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nologwatch
+// +build !nologwatch
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	logwatchSubsystem = "logwatch"
+	// logwatchMaxLineLength is the length sampled lines are truncated to.
+	logwatchMaxLineLength = 512
+)
+
+var (
+	logwatchConfigFile  = kingpin.Flag("collector.logwatch.config", "JSON file listing the log files watched by the logwatch collector and the regexps counted in them.").Default("").String()
+	logwatchSampleLines = kingpin.Flag("collector.logwatch.sample-lines", "Number of last matching lines kept per pattern.").Default("5").Int()
+	logwatchMaxRead     = kingpin.Flag("collector.logwatch.max-read", "Maximum number of bytes read from a file in one run.").Default("16MiB").Bytes()
+)
+
+// logwatchConfig is the --collector.logwatch.config file:
+//
+//	{"files": [
+//	  {"path": "/var/log/kern.log", "patterns": {"oom": "Out of memory", "io_error": "I/O error"}}
+//	]}
+type logwatchConfig struct {
+	Files []struct {
+		Path     string            `json:"path"`
+		Patterns map[string]string `json:"patterns"`
+	} `json:"files"`
+}
+
+type logPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type watchedLog struct {
+	path     string
+	patterns []logPattern
+}
+
+// logSample is a line that matched a pattern.
+type logSample struct {
+	Time float64 `json:"time"`
+	Line string  `json:"line"`
+}
+
+// logFileState is how far a file has been read, and what was found in it so
+// far. Inode detects rotation; an offset past the end detects truncation.
+type logFileState struct {
+	Inode   uint64                 `json:"inode"`
+	Offset  int64                  `json:"offset"`
+	Counts  map[string]float64     `json:"counts"`
+	Samples map[string][]logSample `json:"samples"`
+}
+
+type logwatchCollector struct {
+	files       []watchedLog
+	statePath   string
+	sampleLines int
+	maxRead     int64
+	now         func() time.Time
+
+	matches  *prometheus.Desc
+	sample   *prometheus.Desc
+	readable *prometheus.Desc
+	logger   log.Logger
+}
+
+func init() {
+	registerCollector("logwatch", defaultDisabled, NewLogwatchCollector)
+}
+
+// NewLogwatchCollector returns a new Collector counting the lines of log
+// files matching the regexps listed in --collector.logwatch.config.
+func NewLogwatchCollector(logger log.Logger) (Collector, error) {
+	files, err := loadLogwatchConfig(*logwatchConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return newLogwatchCollector(files, stateFilePath("logwatch.json"), *logwatchSampleLines, int64(*logwatchMaxRead), logger), nil
+}
+
+func newLogwatchCollector(files []watchedLog, statePath string, sampleLines int, maxRead int64, logger log.Logger) *logwatchCollector {
+	return &logwatchCollector{
+		files:       files,
+		statePath:   statePath,
+		sampleLines: sampleLines,
+		maxRead:     maxRead,
+		now:         time.Now,
+		matches: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logwatchSubsystem, "matches_total"),
+			"Number of lines matching the pattern since the file was first watched.",
+			[]string{"file", "pattern"}, nil,
+		),
+		sample: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logwatchSubsystem, "sample_info"),
+			"A recent line matching the pattern. The value is the time the line was read since unix epoch in seconds.",
+			[]string{"file", "pattern", "line"}, nil,
+		),
+		readable: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, logwatchSubsystem, "file_readable"),
+			"Whether the log file could be read.",
+			[]string{"file"}, nil,
+		),
+		logger: logger,
+	}
+}
+
+func loadLogwatchConfig(path string) ([]watchedLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logwatch config: %w", err)
+	}
+	var config logwatchConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse logwatch config %q: %w", path, err)
+	}
+
+	files := make([]watchedLog, 0, len(config.Files))
+	for _, f := range config.Files {
+		if f.Path == "" || len(f.Patterns) == 0 {
+			return nil, fmt.Errorf("logwatch config %q: every file needs a path and patterns", path)
+		}
+		w := watchedLog{path: f.Path}
+		for name, pattern := range f.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("logwatch config %q: invalid regexp for pattern %s: %w", path, name, err)
+			}
+			w.patterns = append(w.patterns, logPattern{name: name, re: re})
+		}
+		sort.Slice(w.patterns, func(i, j int) bool { return w.patterns[i].name < w.patterns[j].name })
+		files = append(files, w)
+	}
+	return files, nil
+}
+
+// Update implements the Collector interface.
+func (c *logwatchCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.files) == 0 {
+		return ErrNoData
+	}
+
+	states := map[string]*logFileState{}
+	if err := loadState(c.statePath, &states); err != nil {
+		// Starting over only loses the lines written since the last run.
+		level.Warn(c.logger).Log("msg", "ignoring logwatch state", "err", err)
+		states = map[string]*logFileState{}
+	}
+
+	for _, f := range c.files {
+		state := states[f.path]
+		readable := 1.0
+		next, err := c.watch(f, state)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "failed to read log file", "file", f.path, "err", err)
+			readable = 0
+		} else {
+			state = next
+			states[f.path] = state
+		}
+		ch <- prometheus.MustNewConstMetric(c.readable, prometheus.GaugeValue, readable, f.path)
+		if state == nil {
+			continue
+		}
+		for _, p := range f.patterns {
+			ch <- prometheus.MustNewConstMetric(c.matches, prometheus.CounterValue, state.Counts[p.name], f.path, p.name)
+			seen := map[string]bool{}
+			samples := state.Samples[p.name]
+			for i := len(samples) - 1; i >= 0; i-- {
+				// States saved by earlier versions may hold invalid lines.
+				line := sampleLine(samples[i].Line)
+				// Identical lines would make identical series; keep the latest.
+				if seen[line] {
+					continue
+				}
+				seen[line] = true
+				ch <- prometheus.MustNewConstMetric(c.sample, prometheus.GaugeValue, samples[i].Time, f.path, p.name, line)
+			}
+		}
+	}
+
+	return saveState(c.statePath, states)
+}
+
+// sampleLine returns line as a valid label value: invalid UTF-8 replaced
+// and truncated to logwatchMaxLineLength bytes on a character boundary.
+func sampleLine(line string) string {
+	line = strings.ToValidUTF8(line, "\uFFFD")
+	if len(line) <= logwatchMaxLineLength {
+		return line
+	}
+	n := logwatchMaxLineLength
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return line[:n]
+}
+
+// watch reads the lines appended to the file since state and returns the
+// updated state. A file seen for the first time is read from its end.
+func (c *logwatchCollector) watch(f watchedLog, state *logFileState) (*logFileState, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	inode := fileInode(info)
+
+	if state == nil {
+		return &logFileState{Inode: inode, Offset: info.Size(), Counts: map[string]float64{}, Samples: map[string][]logSample{}}, nil
+	}
+	next := *state
+	if next.Counts == nil {
+		next.Counts = map[string]float64{}
+	}
+	if next.Samples == nil {
+		next.Samples = map[string][]logSample{}
+	}
+
+	switch {
+	case inode != state.Inode:
+		// Finish the rotated file if it can still be found, then start the
+		// new one from its beginning.
+		if rotated, err := os.Stat(f.path + ".1"); err == nil && fileInode(rotated) == state.Inode {
+			if _, err := c.read(f.path+".1", f.patterns, state.Offset, &next); err != nil {
+				level.Debug(c.logger).Log("msg", "failed to read rotated log file", "file", f.path+".1", "err", err)
+			}
+		}
+		next.Inode, next.Offset = inode, 0
+	case info.Size() < state.Offset:
+		level.Debug(c.logger).Log("msg", "log file truncated", "file", f.path)
+		next.Offset = 0
+	}
+
+	if next.Offset, err = c.read(f.path, f.patterns, next.Offset, &next); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// read counts the complete lines of path from offset on, at most maxRead
+// bytes, and returns the offset following the last complete line.
+func (c *logwatchCollector) read(path string, patterns []logPattern, offset int64, state *logFileState) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	now := float64(c.now().UnixNano()) / 1e9
+	r := bufio.NewReader(io.LimitReader(file, c.maxRead))
+	consumed := int64(0)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return offset + consumed, err
+		}
+		consumed += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+		for _, p := range patterns {
+			if !p.re.MatchString(line) {
+				continue
+			}
+			state.Counts[p.name]++
+			samples := append(state.Samples[p.name], logSample{Time: now, Line: sampleLine(line)})
+			if len(samples) > c.sampleLines {
+				samples = samples[len(samples)-c.sampleLines:]
+			}
+			state.Samples[p.name] = samples
+		}
+	}
+	if consumed == 0 && c.maxRead > 0 {
+		// A line longer than maxRead would never complete; skip it.
+		if info, err := file.Stat(); err == nil && info.Size()-offset >= c.maxRead {
+			level.Warn(c.logger).Log("msg", "skipping overlong log line", "file", path, "offset", offset)
+			return offset + c.maxRead, nil
+		}
+	}
+	return offset + consumed, nil
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nologwatch
+// +build !nologwatch
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func appendLog(t *testing.T, path, lines string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(lines); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogwatchCollector(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLog(t, path, "error: before the first run\n")
+
+	files := []watchedLog{{path: path, patterns: []logPattern{
+		{name: "error", re: regexp.MustCompile("error")},
+		{name: "oom", re: regexp.MustCompile("Out of memory")},
+	}}}
+	statePath := filepath.Join(dir, "state", "logwatch.json")
+
+	// Each run uses a new collector, as each run of the agent does.
+	run := func(want string) {
+		t.Helper()
+		c := newLogwatchCollector(files, statePath, 2, 1<<20, log.NewNopLogger())
+		c.now = func() time.Time { return time.Unix(1700000000, 0) }
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectorAdapter{c})
+		want = strings.ReplaceAll(want, "FILE", path)
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_logwatch_matches_total", "node_logwatch_sample_info"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := `# HELP node_logwatch_matches_total Number of lines matching the pattern since the file was first watched.
+# TYPE node_logwatch_matches_total counter
+`
+	samples := `# HELP node_logwatch_sample_info A recent line matching the pattern. The value is the time the line was read since unix epoch in seconds.
+# TYPE node_logwatch_sample_info gauge
+`
+
+	// The first run starts at the end of the file.
+	run(header + `node_logwatch_matches_total{file="FILE",pattern="error"} 0
+node_logwatch_matches_total{file="FILE",pattern="oom"} 0
+`)
+
+	// Only complete lines are counted, and only the last two are sampled.
+	appendLog(t, path, "error: one\nerror: two\nOut of memory: Killed process 42\nerror: three\nerror: partial")
+	run(header + `node_logwatch_matches_total{file="FILE",pattern="error"} 3
+node_logwatch_matches_total{file="FILE",pattern="oom"} 1
+` + samples + `node_logwatch_sample_info{file="FILE",line="Out of memory: Killed process 42",pattern="oom"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: three",pattern="error"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: two",pattern="error"} 1.7e+09
+`)
+
+	// The rotated file is finished before the new one is read.
+	appendLog(t, path, "\nerror: four\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, "error: five\n")
+	run(header + `node_logwatch_matches_total{file="FILE",pattern="error"} 6
+node_logwatch_matches_total{file="FILE",pattern="oom"} 1
+` + samples + `node_logwatch_sample_info{file="FILE",line="Out of memory: Killed process 42",pattern="oom"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: five",pattern="error"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: four",pattern="error"} 1.7e+09
+`)
+
+	// A truncated file is read again from its beginning.
+	if err := os.WriteFile(path, []byte("error: six\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run(header + `node_logwatch_matches_total{file="FILE",pattern="error"} 7
+node_logwatch_matches_total{file="FILE",pattern="oom"} 1
+` + samples + `node_logwatch_sample_info{file="FILE",line="Out of memory: Killed process 42",pattern="oom"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: five",pattern="error"} 1.7e+09
+node_logwatch_sample_info{file="FILE",line="error: six",pattern="error"} 1.7e+09
+`)
+}
+
+func TestLogwatchInvalidLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLog(t, path, "")
+	files := []watchedLog{{path: path, patterns: []logPattern{{name: "error", re: regexp.MustCompile("errors")}}}}
+	statePath := filepath.Join(dir, "logwatch.json")
+	gather := func() []*dto.MetricFamily {
+		t.Helper()
+		c := newLogwatchCollector(files, statePath, 5, 1<<20, log.NewNopLogger())
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectorAdapter{c})
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mfs
+	}
+	gather()
+
+	// A line over the length limit whose cut falls within a character, and
+	// one that is not valid UTF-8.
+	appendLog(t, path, "errors "+strings.Repeat("é", 300)+"\nerrors \xff\xfe\n")
+	var lines []string
+	for _, mf := range gather() {
+		if mf.GetName() != "node_logwatch_sample_info" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "line" {
+					lines = append(lines, l.GetValue())
+				}
+			}
+		}
+	}
+	want := []string{"errors " + strings.Repeat("é", 252), "errors �"}
+	sort.Strings(lines)
+	sort.Strings(want)
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("want sampled lines %q, got %q", want, lines)
+	}
+	for _, l := range lines {
+		if len(l) > logwatchMaxLineLength || !utf8.ValidString(l) {
+			t.Errorf("invalid sampled line %q", l)
+		}
+	}
+}
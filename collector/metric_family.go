@@ -0,0 +1,225 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonMetric is a single sample in the JSON metrics format, which is a list
+// of such objects:
+//
+//	[
+//	  {"name": "app_queue_depth", "help": "Jobs waiting.", "type": "gauge", "labels": {"queue": "mail"}, "value": 3}
+//	]
+//
+// "help" is optional, "type" is one of "gauge", "counter" or "untyped" and
+// defaults to "untyped", and "labels" may be omitted.
+type jsonMetric struct {
+	Name   string            `json:"name"`
+	Help   string            `json:"help"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+	Value  *float64          `json:"value"`
+}
+
+var jsonMetricTypes = map[string]dto.MetricType{
+	"":        dto.MetricType_UNTYPED,
+	"untyped": dto.MetricType_UNTYPED,
+	"gauge":   dto.MetricType_GAUGE,
+	"counter": dto.MetricType_COUNTER,
+}
+
+// parseJSONMetrics reads metrics in the JSON metrics format and groups them
+// into metric families keyed by name.
+func parseJSONMetrics(r io.Reader) (map[string]*dto.MetricFamily, error) {
+	var metrics []jsonMetric
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON metrics: %w", err)
+	}
+
+	families := map[string]*dto.MetricFamily{}
+	for i, m := range metrics {
+		if !model.IsValidMetricName(model.LabelValue(m.Name)) {
+			return nil, fmt.Errorf("metric %d: invalid metric name %q", i, m.Name)
+		}
+		typ, ok := jsonMetricTypes[m.Type]
+		if !ok {
+			return nil, fmt.Errorf("metric %q: unsupported type %q", m.Name, m.Type)
+		}
+		if m.Value == nil {
+			return nil, fmt.Errorf("metric %q: missing value", m.Name)
+		}
+
+		mf, ok := families[m.Name]
+		if !ok {
+			mf = &dto.MetricFamily{Name: proto.String(m.Name), Type: typ.Enum()}
+			families[m.Name] = mf
+		}
+		if mf.GetType() != typ {
+			return nil, fmt.Errorf("metric %q: type %q conflicts with earlier samples", m.Name, m.Type)
+		}
+		if m.Help != "" && mf.Help == nil {
+			mf.Help = proto.String(m.Help)
+		}
+
+		metric := &dto.Metric{}
+		names := make([]string, 0, len(m.Labels))
+		for name := range m.Labels {
+			if !model.LabelName(name).IsValid() {
+				return nil, fmt.Errorf("metric %q: invalid label name %q", m.Name, name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(m.Labels[name])})
+		}
+		switch typ {
+		case dto.MetricType_GAUGE:
+			metric.Gauge = &dto.Gauge{Value: m.Value}
+		case dto.MetricType_COUNTER:
+			metric.Counter = &dto.Counter{Value: m.Value}
+		default:
+			metric.Untyped = &dto.Untyped{Value: m.Value}
+		}
+		mf.Metric = append(mf.Metric, metric)
+	}
+	return families, nil
+}
+
+func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Metric, logger log.Logger) {
+	var valType prometheus.ValueType
+	var val float64
+
+	allLabelNames := map[string]struct{}{}
+	for _, metric := range metricFamily.Metric {
+		labels := metric.GetLabel()
+		for _, label := range labels {
+			if _, ok := allLabelNames[label.GetName()]; !ok {
+				allLabelNames[label.GetName()] = struct{}{}
+			}
+		}
+	}
+
+	for _, metric := range metricFamily.Metric {
+		if metric.TimestampMs != nil {
+			level.Warn(logger).Log("msg", "Ignoring unsupported custom timestamp on textfile collector metric", "metric", metric)
+		}
+
+		labels := metric.GetLabel()
+		var names []string
+		var values []string
+		for _, label := range labels {
+			names = append(names, label.GetName())
+			values = append(values, label.GetValue())
+		}
+
+		for k := range allLabelNames {
+			present := false
+			for _, name := range names {
+				if k == name {
+					present = true
+					break
+				}
+			}
+			if !present {
+				names = append(names, k)
+				values = append(values, "")
+			}
+		}
+
+		metricType := metricFamily.GetType()
+		switch metricType {
+		case dto.MetricType_COUNTER:
+			valType = prometheus.CounterValue
+			val = metric.Counter.GetValue()
+
+		case dto.MetricType_GAUGE:
+			valType = prometheus.GaugeValue
+			val = metric.Gauge.GetValue()
+
+		case dto.MetricType_UNTYPED:
+			valType = prometheus.UntypedValue
+			val = metric.Untyped.GetValue()
+
+		case dto.MetricType_SUMMARY:
+			quantiles := map[float64]float64{}
+			for _, q := range metric.Summary.Quantile {
+				quantiles[q.GetQuantile()] = q.GetValue()
+			}
+			ch <- prometheus.MustNewConstSummary(
+				prometheus.NewDesc(
+					*metricFamily.Name,
+					metricFamily.GetHelp(),
+					names, nil,
+				),
+				metric.Summary.GetSampleCount(),
+				metric.Summary.GetSampleSum(),
+				quantiles, values...,
+			)
+		case dto.MetricType_HISTOGRAM:
+			buckets := map[float64]uint64{}
+			for _, b := range metric.Histogram.Bucket {
+				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+			}
+			ch <- prometheus.MustNewConstHistogram(
+				prometheus.NewDesc(
+					*metricFamily.Name,
+					metricFamily.GetHelp(),
+					names, nil,
+				),
+				metric.Histogram.GetSampleCount(),
+				metric.Histogram.GetSampleSum(),
+				buckets, values...,
+			)
+		default:
+			panic("unknown metric type")
+		}
+		if metricType == dto.MetricType_GAUGE || metricType == dto.MetricType_COUNTER || metricType == dto.MetricType_UNTYPED {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					*metricFamily.Name,
+					metricFamily.GetHelp(),
+					names, nil,
+				),
+				valType, val, values...,
+			)
+		}
+	}
+}
+
+// hasTimestamps returns true when metrics contain unsupported timestamps.
+func hasTimestamps(parsedFamilies map[string]*dto.MetricFamily) bool {
+	for _, mf := range parsedFamilies {
+		for _, m := range mf.Metric {
+			if m.TimestampMs != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -31,7 +31,7 @@ var (
 )
 
 func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
-	if *netDevNetlink {
+	if *netDevNetlink && !fixtures {
 		return netlinkStats(filter, logger)
 	}
 	return procNetDevStats(filter, logger)
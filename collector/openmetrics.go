@@ -0,0 +1,200 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const openMetricsEOF = "# EOF"
+
+// isOpenMetrics reports whether data ends with the OpenMetrics "# EOF" marker.
+func isOpenMetrics(data []byte) bool {
+	trimmed := bytes.TrimRight(data, "\n")
+	return bytes.HasSuffix(trimmed, []byte("\n"+openMetricsEOF)) || string(trimmed) == openMetricsEOF
+}
+
+// openMetricsToText rewrites OpenMetrics text into the Prometheus text
+// exposition format understood by expfmt.TextParser:
+//
+//   - "# EOF" is required and removed, and nothing may follow it;
+//   - "# UNIT" lines and exemplars are dropped;
+//   - counter families are renamed to their "_total" samples and info
+//     families to their "_info" samples, both exposed as their classic types;
+//   - "_created" samples of counters, histograms and summaries are dropped;
+//   - stateset and gaugehistogram families become gauges and histograms and
+//     unknown families become untyped;
+//   - timestamps are converted from seconds to milliseconds.
+func openMetricsToText(data []byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 0 || lines[len(lines)-1] != openMetricsEOF {
+		return nil, errors.New("OpenMetrics input does not end with \"# EOF\"")
+	}
+	lines = lines[:len(lines)-1]
+
+	// Types are needed before HELP lines are rewritten, which may precede them.
+	types := map[string]string{}
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			types[fields[2]] = fields[3]
+		}
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		if line == openMetricsEOF {
+			return nil, fmt.Errorf("line %d: content after \"# EOF\"", i+1)
+		}
+		if strings.HasPrefix(line, "#") {
+			rewritten, err := rewriteOpenMetricsComment(line, types)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if rewritten != "" {
+				out.WriteString(rewritten)
+				out.WriteByte('\n')
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rewritten, err := rewriteOpenMetricsSample(line, types)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if rewritten != "" {
+			out.WriteString(rewritten)
+			out.WriteByte('\n')
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// classicFamily returns the name and type the family has in the classic
+// text format.
+func classicFamily(name, typ string) (string, string) {
+	switch typ {
+	case "counter":
+		return name + "_total", "counter"
+	case "info":
+		return name + "_info", "gauge"
+	case "stateset":
+		return name, "gauge"
+	case "gaugehistogram":
+		return name, "histogram"
+	case "gauge", "histogram", "summary":
+		return name, typ
+	default:
+		return name, "untyped"
+	}
+}
+
+func rewriteOpenMetricsComment(line string, types map[string]string) (string, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || fields[0] != "#" {
+		return "", fmt.Errorf("malformed comment %q", line)
+	}
+	switch fields[1] {
+	case "UNIT":
+		return "", nil
+	case "TYPE":
+		name, typ := classicFamily(fields[2], types[fields[2]])
+		return "# TYPE " + name + " " + typ, nil
+	case "HELP":
+		name, _ := classicFamily(fields[2], types[fields[2]])
+		help := ""
+		if len(fields) == 4 {
+			help = fields[3]
+		}
+		return "# HELP " + name + " " + help, nil
+	default:
+		return "", fmt.Errorf("unknown comment %q", line)
+	}
+}
+
+func rewriteOpenMetricsSample(line string, types map[string]string) (string, error) {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", fmt.Errorf("malformed sample %q", line)
+	}
+	name := line[:end]
+
+	// Skip the label set, whose values may contain " # ".
+	rest := line[end:]
+	labels := ""
+	if strings.HasPrefix(rest, "{") {
+		closing := labelSetEnd(rest)
+		if closing < 0 {
+			return "", fmt.Errorf("unterminated label set in %q", line)
+		}
+		labels, rest = rest[:closing+1], rest[closing+1:]
+	}
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest = rest[:i]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", fmt.Errorf("malformed sample %q", line)
+	}
+
+	for family, typ := range types {
+		if name == family+"_created" && (typ == "counter" || typ == "histogram" || typ == "summary") {
+			return "", nil
+		}
+		if typ == "gaugehistogram" {
+			switch name {
+			case family + "_gcount":
+				name = family + "_count"
+			case family + "_gsum":
+				name = family + "_sum"
+			}
+		}
+	}
+
+	sample := name + labels + " " + fields[0]
+	if len(fields) == 2 {
+		seconds, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid timestamp in %q: %w", line, err)
+		}
+		sample += " " + strconv.FormatInt(int64(seconds*1000), 10)
+	}
+	return sample, nil
+}
+
+// labelSetEnd returns the index of the brace closing the label set at the
+// start of s, or -1.
+func labelSetEnd(s string) int {
+	inQuotes := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case '}':
+			if !inQuotes {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -55,3 +55,17 @@ func rootfsStripPrefix(path string) string {
 	}
 	return stripped
 }
+
+// fixtures is set when collecting from a host snapshot, where sources other
+// than files, such as netlink, would read the live host.
+var fixtures bool
+
+// UseFixtures points the proc, sys, rootfs and udev data paths at a host
+// snapshot: dir/proc, dir/sys, dir itself and dir/udev/data.
+func UseFixtures(dir string) {
+	fixtures = true
+	*procPath = filepath.Join(dir, "proc")
+	*sysPath = filepath.Join(dir, "sys")
+	*rootfsPath = dir
+	*udevDataPath = filepath.Join(dir, "udev", "data")
+}
@@ -0,0 +1,380 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprobe
+// +build !noprobe
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	probeSubsystem = "probe"
+
+	probeTCP  = "tcp"
+	probeHTTP = "http"
+	probeDNS  = "dns"
+	probeICMP = "icmp"
+
+	// probeMaxBody is how much of an HTTP response body is read.
+	probeMaxBody = 1 << 20
+)
+
+var (
+	probeConfigFile = kingpin.Flag("collector.probe.config", "JSON file listing the targets probed by the probe collector.").Default("").String()
+	probeTimeout    = kingpin.Flag("collector.probe.timeout", "Default timeout of a single probe.").Default("5s").Duration()
+)
+
+// probeConfigEntry is one probe in the --collector.probe.config file:
+//
+//	{"probes": [
+//	  {"name": "db", "type": "tcp", "target": "10.0.0.5:5432"},
+//	  {"name": "api", "type": "http", "target": "https://api.example.com/health", "expect_status": [200]},
+//	  {"name": "resolver", "type": "dns", "target": "example.com", "server": "10.0.0.53:53"},
+//	  {"name": "gateway", "type": "icmp", "target": "10.0.0.1", "timeout": "2s"}
+//	]}
+//
+// ICMP probes need an unprivileged ICMP socket (net.ipv4.ping_group_range)
+// or raw socket privileges.
+type probeConfigEntry struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Target  string `json:"target"`
+	Timeout string `json:"timeout"`
+	// ExpectStatus lists the HTTP status codes counted as success, 2xx and
+	// 3xx when empty.
+	ExpectStatus       []int `json:"expect_status"`
+	InsecureSkipVerify bool  `json:"insecure_skip_verify"`
+	// Server is the DNS server queried instead of the system resolver.
+	Server string `json:"server"`
+}
+
+type probeConfig struct {
+	Probes []probeConfigEntry `json:"probes"`
+}
+
+type probe struct {
+	probeConfigEntry
+	timeout time.Duration
+}
+
+// probeResult is the outcome of a probe. Duration is the TCP connect time,
+// the HTTP request time, the DNS resolution time or the ICMP round trip.
+type probeResult struct {
+	duration   time.Duration
+	statusCode int
+	tlsExpiry  time.Time
+	err        error
+}
+
+type probeCollector struct {
+	probes []probe
+
+	success    *prometheus.Desc
+	duration   *prometheus.Desc
+	statusCode *prometheus.Desc
+	tlsExpiry  *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("probe", defaultDisabled, NewProbeCollector)
+}
+
+// NewProbeCollector returns a new Collector probing the reachability of the
+// targets listed in --collector.probe.config.
+func NewProbeCollector(logger log.Logger) (Collector, error) {
+	probes, err := loadProbeConfig(*probeConfigFile, *probeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newProbeCollector(probes, logger), nil
+}
+
+func newProbeCollector(probes []probe, logger log.Logger) *probeCollector {
+	labels := []string{"probe", "type", "target"}
+	return &probeCollector{
+		probes: probes,
+		success: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, probeSubsystem, "success"),
+			"Whether the probe succeeded.",
+			labels, nil,
+		),
+		duration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, probeSubsystem, "duration_seconds"),
+			"TCP connect time, HTTP request time, DNS resolution time or ICMP round trip time of the probe.",
+			labels, nil,
+		),
+		statusCode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, probeSubsystem, "http_status_code"),
+			"Status code of the HTTP response.",
+			labels, nil,
+		),
+		tlsExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, probeSubsystem, "tls_cert_expiry_seconds"),
+			"Expiry time of the certificate presented by the server since unix epoch in seconds.",
+			labels, nil,
+		),
+		logger: logger,
+	}
+}
+
+func loadProbeConfig(path string, defaultTimeout time.Duration) ([]probe, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read probe config: %w", err)
+	}
+	var config probeConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse probe config %q: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	probes := make([]probe, 0, len(config.Probes))
+	for _, entry := range config.Probes {
+		if entry.Name == "" || entry.Target == "" {
+			return nil, fmt.Errorf("probe config %q: every probe needs a name and a target", path)
+		}
+		if seen[entry.Name] {
+			return nil, fmt.Errorf("probe config %q: duplicate probe %q", path, entry.Name)
+		}
+		seen[entry.Name] = true
+		switch entry.Type {
+		case probeTCP, probeHTTP, probeDNS, probeICMP:
+		default:
+			return nil, fmt.Errorf("probe %q: unsupported type %q", entry.Name, entry.Type)
+		}
+
+		p := probe{probeConfigEntry: entry, timeout: defaultTimeout}
+		if entry.Timeout != "" {
+			if p.timeout, err = time.ParseDuration(entry.Timeout); err != nil {
+				return nil, fmt.Errorf("probe %q: invalid timeout: %w", entry.Name, err)
+			}
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// Update implements the Collector interface.
+func (c *probeCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.probes) == 0 {
+		return ErrNoData
+	}
+
+	results := make([]probeResult, len(c.probes))
+	var wg sync.WaitGroup
+	wg.Add(len(c.probes))
+	for i, p := range c.probes {
+		go func(i int, p probe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+			defer cancel()
+			results[i] = runProbe(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i, p := range c.probes {
+		result := results[i]
+		labels := []string{p.Name, p.Type, p.Target}
+		success := 1.0
+		if result.err != nil {
+			level.Debug(c.logger).Log("msg", "probe failed", "probe", p.Name, "err", result.err)
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.success, prometheus.GaugeValue, success, labels...)
+		ch <- prometheus.MustNewConstMetric(c.duration, prometheus.GaugeValue, result.duration.Seconds(), labels...)
+		if result.statusCode != 0 {
+			ch <- prometheus.MustNewConstMetric(c.statusCode, prometheus.GaugeValue, float64(result.statusCode), labels...)
+		}
+		if !result.tlsExpiry.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.tlsExpiry, prometheus.GaugeValue, float64(result.tlsExpiry.Unix()), labels...)
+		}
+	}
+	return nil
+}
+
+func runProbe(ctx context.Context, p probe) probeResult {
+	switch p.Type {
+	case probeTCP:
+		return probeTCPConnect(ctx, p)
+	case probeHTTP:
+		return probeHTTPRequest(ctx, p)
+	case probeDNS:
+		return probeDNSLookup(ctx, p)
+	default:
+		return probeICMPEcho(ctx, p)
+	}
+}
+
+func probeTCPConnect(ctx context.Context, p probe) probeResult {
+	var d net.Dialer
+	begin := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", p.Target)
+	result := probeResult{duration: time.Since(begin), err: err}
+	if err == nil {
+		conn.Close()
+	}
+	return result
+}
+
+func probeHTTPRequest(ctx context.Context, p probe) probeResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Target, nil)
+	if err != nil {
+		return probeResult{err: err}
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+
+	begin := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return probeResult{duration: time.Since(begin), err: err}
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, probeMaxBody))
+	result := probeResult{duration: time.Since(begin), statusCode: resp.StatusCode, err: err}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.tlsExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	if result.err == nil && !expectedStatus(resp.StatusCode, p.ExpectStatus) {
+		result.err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return result
+}
+
+func expectedStatus(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, e := range expected {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
+
+func probeDNSLookup(ctx context.Context, p probe) probeResult {
+	resolver := net.DefaultResolver
+	if p.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, p.Server)
+			},
+		}
+	}
+	begin := time.Now()
+	addrs, err := resolver.LookupIPAddr(ctx, p.Target)
+	result := probeResult{duration: time.Since(begin), err: err}
+	if err == nil && len(addrs) == 0 {
+		result.err = fmt.Errorf("no addresses for %s", p.Target)
+	}
+	return result
+}
+
+func probeICMPEcho(ctx context.Context, p probe) probeResult {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, p.Target)
+	if err != nil {
+		return probeResult{err: err}
+	}
+	var ip net.IP
+	for _, a := range addrs {
+		if ip4 := a.IP.To4(); ip4 != nil {
+			ip = ip4
+			break
+		}
+	}
+	if ip == nil {
+		return probeResult{err: fmt.Errorf("no IPv4 address for %s", p.Target)}
+	}
+
+	// Unprivileged ICMP sockets are tried first; the kernel then sets the
+	// echo identifier, so replies are matched on the sequence number only.
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	raw := false
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		dst, raw = &net.IPAddr{IP: ip}, true
+		if conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+			return probeResult{err: fmt.Errorf("ICMP not permitted: %w", err)}
+		}
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	id, seq := os.Getpid()&0xffff, int(time.Now().UnixNano()&0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("node_exporter probe")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return probeResult{err: err}
+	}
+
+	begin := time.Now()
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return probeResult{err: err}
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return probeResult{duration: time.Since(begin), err: err}
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || reply.Type != ipv4.ICMPTypeEchoReply || echo.Seq != seq || (raw && echo.ID != id) {
+			continue
+		}
+		return probeResult{duration: time.Since(begin)}
+	}
+}
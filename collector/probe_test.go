@@ -0,0 +1,173 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprobe
+// +build !noprobe
+
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers every A query with 127.0.0.1 and every other query with
+// no records.
+func serveDNS(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			reply := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+			}
+			if q.Type == dnsmessage.TypeA && q.Name.String() == "db.example.com." {
+				reply.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			} else if q.Name.String() != "db.example.com." {
+				reply.RCode = dnsmessage.RCodeNameError
+			}
+			packed, err := reply.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestRunProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(mux)
+	defer tlsServer.Close()
+
+	dnsServer := serveDNS(t)
+
+	tests := []struct {
+		name       string
+		probe      probeConfigEntry
+		success    bool
+		statusCode int
+		tls        bool
+	}{
+		{name: "tcp open", probe: probeConfigEntry{Type: probeTCP, Target: listener.Addr().String()}, success: true},
+		{name: "tcp closed", probe: probeConfigEntry{Type: probeTCP, Target: closedAddr}},
+		{name: "http ok", probe: probeConfigEntry{Type: probeHTTP, Target: server.URL + "/health"}, success: true, statusCode: 200},
+		{name: "http error status", probe: probeConfigEntry{Type: probeHTTP, Target: server.URL + "/broken"}, statusCode: 500},
+		{name: "http expected status", probe: probeConfigEntry{Type: probeHTTP, Target: server.URL + "/broken", ExpectStatus: []int{500}}, success: true, statusCode: 500},
+		{name: "https untrusted", probe: probeConfigEntry{Type: probeHTTP, Target: tlsServer.URL + "/health"}},
+		{name: "https", probe: probeConfigEntry{Type: probeHTTP, Target: tlsServer.URL + "/health", InsecureSkipVerify: true}, success: true, statusCode: 200, tls: true},
+		{name: "dns", probe: probeConfigEntry{Type: probeDNS, Target: "db.example.com", Server: dnsServer}, success: true},
+		{name: "dns unknown name", probe: probeConfigEntry{Type: probeDNS, Target: "missing.example.com", Server: dnsServer}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result := runProbe(ctx, probe{probeConfigEntry: test.probe, timeout: 5 * time.Second})
+			if success := result.err == nil; success != test.success {
+				t.Fatalf("expected success %t, got error %v", test.success, result.err)
+			}
+			if result.statusCode != test.statusCode {
+				t.Errorf("expected status code %d, got %d", test.statusCode, result.statusCode)
+			}
+			if tls := !result.tlsExpiry.IsZero(); tls != test.tls {
+				t.Errorf("expected TLS expiry %t, got %s", test.tls, result.tlsExpiry)
+			}
+			if test.success && result.duration <= 0 {
+				t.Errorf("expected a duration, got %s", result.duration)
+			}
+		})
+	}
+}
+
+func TestRunProbeICMP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result := runProbe(ctx, probe{probeConfigEntry: probeConfigEntry{Type: probeICMP, Target: "127.0.0.1"}})
+	if result.err != nil && strings.Contains(result.err.Error(), "not permitted") {
+		t.Skip(result.err)
+	}
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+}
+
+func TestProbeCollector(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	target := listener.Addr().String()
+
+	c := newProbeCollector([]probe{
+		{probeConfigEntry: probeConfigEntry{Name: "db", Type: probeTCP, Target: target}, timeout: time.Second},
+	}, log.NewNopLogger())
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+
+	want := `# HELP node_probe_success Whether the probe succeeded.
+# TYPE node_probe_success gauge
+node_probe_success{probe="db",target="` + target + `",type="tcp"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_probe_success"); err != nil {
+		t.Fatal(err)
+	}
+}
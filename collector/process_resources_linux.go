@@ -0,0 +1,242 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprocess
+// +build !noprocess
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const processResourceSubsystem = "process"
+
+var (
+	processInclude      = kingpin.Flag("collector.process.include", "Regexp of process names to report.").Default(".*").String()
+	processExclude      = kingpin.Flag("collector.process.exclude", "Regexp of process names not to report.").Default("").String()
+	processMatchCmdline = kingpin.Flag("collector.process.match-cmdline", "Match the regexps against the full command line instead of the process name.").Bool()
+	processGroups       = kingpin.Flag("collector.process.group", "Report processes matching REGEXP summed up as NAME instead of one by one. May be repeated.").PlaceHolder("NAME=REGEXP").StringMap()
+)
+
+// processGroup is a named set of processes whose resources are summed.
+type processGroup struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type processResourceCollector struct {
+	fs           procfs.FS
+	include      *regexp.Regexp
+	exclude      *regexp.Regexp
+	matchCmdline bool
+	groups       []processGroup
+
+	cpu     *prometheus.Desc
+	rss     *prometheus.Desc
+	fds     *prometheus.Desc
+	read    *prometheus.Desc
+	written *prometheus.Desc
+	threads *prometheus.Desc
+	count   *prometheus.Desc
+	logger  log.Logger
+}
+
+// processUsage is the resource usage of a process or group of processes.
+type processUsage struct {
+	labels  []string
+	cpu     float64
+	rss     float64
+	fds     float64
+	read    float64
+	written float64
+	threads float64
+	count   float64
+	// hasFDs and hasIO are false when no process allowed reading them.
+	hasFDs bool
+	hasIO  bool
+}
+
+func init() {
+	registerCollector("process", defaultDisabled, NewProcessResourceCollector)
+}
+
+// NewProcessResourceCollector returns a new Collector exposing the resource
+// usage of individual processes, or of groups of processes, read from
+// /proc/[pid].
+func NewProcessResourceCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	groups, err := parseProcessGroups(*processGroups)
+	if err != nil {
+		return nil, err
+	}
+	return newProcessResourceCollector(fs, *processInclude, *processExclude, *processMatchCmdline, groups, logger)
+}
+
+func parseProcessGroups(groups map[string]string) ([]processGroup, error) {
+	result := make([]processGroup, 0, len(groups))
+	for name, pattern := range groups {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for process group %s: %w", name, err)
+		}
+		result = append(result, processGroup{name: name, pattern: re})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, nil
+}
+
+func newProcessResourceCollector(fs procfs.FS, include, exclude string, matchCmdline bool, groups []processGroup, logger log.Logger) (*processResourceCollector, error) {
+	c := &processResourceCollector{
+		fs:           fs,
+		matchCmdline: matchCmdline,
+		groups:       groups,
+		logger:       logger,
+	}
+	var err error
+	if c.include, err = regexp.Compile(include); err != nil {
+		return nil, fmt.Errorf("invalid process include regexp: %w", err)
+	}
+	if exclude != "" {
+		if c.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid process exclude regexp: %w", err)
+		}
+	}
+
+	labels := []string{"name", "pid"}
+	if len(groups) > 0 {
+		labels = []string{"group"}
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, processResourceSubsystem, name), help, labels, nil)
+	}
+	c.cpu = desc("cpu_seconds_total", "User and system CPU time spent.")
+	c.rss = desc("resident_memory_bytes", "Resident memory size.")
+	c.fds = desc("open_fds", "Number of open file descriptors.")
+	c.read = desc("io_read_bytes_total", "Bytes read from storage.")
+	c.written = desc("io_write_bytes_total", "Bytes written to storage.")
+	c.threads = desc("threads", "Number of threads.")
+	if len(groups) > 0 {
+		c.count = desc("count", "Number of processes in the group.")
+	}
+	return c, nil
+}
+
+// Update implements the Collector interface.
+func (c *processResourceCollector) Update(ch chan<- prometheus.Metric) error {
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	usages := map[string]*processUsage{}
+	// Groups are always reported so that an empty group shows a count of 0.
+	for _, g := range c.groups {
+		usages[g.name] = &processUsage{labels: []string{g.name}}
+	}
+	for _, p := range procs {
+		stat, err := p.Stat()
+		if err != nil {
+			// The process may have exited since it was listed.
+			if !errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "failed to read process stat", "pid", p.PID, "err", err)
+			}
+			continue
+		}
+
+		// The kernel truncates comm to 15 bytes, possibly within a
+		// character, and any process can set it: keep label values valid.
+		comm := strings.ToValidUTF8(stat.Comm, "\uFFFD")
+		subject := comm
+		if c.matchCmdline {
+			cmdline, err := p.CmdLine()
+			if err != nil || len(cmdline) == 0 {
+				continue
+			}
+			subject = strings.ToValidUTF8(strings.Join(cmdline, " "), "\uFFFD")
+		}
+		if !c.include.MatchString(subject) || (c.exclude != nil && c.exclude.MatchString(subject)) {
+			continue
+		}
+
+		key, labels := comm+"/"+strconv.Itoa(p.PID), []string{comm, strconv.Itoa(p.PID)}
+		if len(c.groups) > 0 {
+			group, ok := c.groupOf(subject)
+			if !ok {
+				continue
+			}
+			key, labels = group, []string{group}
+		}
+		u, ok := usages[key]
+		if !ok {
+			u = &processUsage{labels: labels}
+			usages[key] = u
+		}
+
+		u.count++
+		u.cpu += stat.CPUTime()
+		u.rss += float64(stat.ResidentMemory())
+		u.threads += float64(stat.NumThreads)
+		if fds, err := p.FileDescriptorsLen(); err == nil {
+			u.fds += float64(fds)
+			u.hasFDs = true
+		}
+		if io, err := p.IO(); err == nil {
+			u.read += float64(io.ReadBytes)
+			u.written += float64(io.WriteBytes)
+			u.hasIO = true
+		}
+	}
+
+	for _, u := range usages {
+		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, u.cpu, u.labels...)
+		ch <- prometheus.MustNewConstMetric(c.rss, prometheus.GaugeValue, u.rss, u.labels...)
+		ch <- prometheus.MustNewConstMetric(c.threads, prometheus.GaugeValue, u.threads, u.labels...)
+		if u.hasFDs {
+			ch <- prometheus.MustNewConstMetric(c.fds, prometheus.GaugeValue, u.fds, u.labels...)
+		}
+		if u.hasIO {
+			ch <- prometheus.MustNewConstMetric(c.read, prometheus.CounterValue, u.read, u.labels...)
+			ch <- prometheus.MustNewConstMetric(c.written, prometheus.CounterValue, u.written, u.labels...)
+		}
+		if c.count != nil {
+			ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, u.count, u.labels...)
+		}
+	}
+	return nil
+}
+
+// groupOf returns the first group, in name order, matching subject.
+func (c *processResourceCollector) groupOf(subject string) (string, bool) {
+	for _, g := range c.groups {
+		if g.pattern.MatchString(subject) {
+			return g.name, true
+		}
+	}
+	return "", false
+}
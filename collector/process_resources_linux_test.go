@@ -0,0 +1,128 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprocess
+// +build !noprocess
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+func TestProcessResourceCollector(t *testing.T) {
+	fs, err := procfs.NewFS("fixtures/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		groups  map[string]string
+		want    string
+	}{
+		{
+			name:    "per process",
+			include: ".*",
+			exclude: "^rcu_",
+			want: `# HELP node_process_cpu_seconds_total User and system CPU time spent.
+# TYPE node_process_cpu_seconds_total counter
+node_process_cpu_seconds_total{name="khungtaskd",pid="10"} 0.14
+node_process_cpu_seconds_total{name="systemd",pid="1"} 1.34
+# HELP node_process_threads Number of threads.
+# TYPE node_process_threads gauge
+node_process_threads{name="khungtaskd",pid="10"} 1
+node_process_threads{name="systemd",pid="1"} 1
+`,
+		},
+		{
+			name:    "groups",
+			include: ".*",
+			groups:  map[string]string{"kernel": "^(khungtaskd|rcu_.*)$", "init": "^systemd$", "web": "^nginx$"},
+			want: `# HELP node_process_count Number of processes in the group.
+# TYPE node_process_count gauge
+node_process_count{group="init"} 1
+node_process_count{group="kernel"} 2
+node_process_count{group="web"} 0
+# HELP node_process_cpu_seconds_total User and system CPU time spent.
+# TYPE node_process_cpu_seconds_total counter
+node_process_cpu_seconds_total{group="init"} 1.34
+node_process_cpu_seconds_total{group="kernel"} 3.6
+node_process_cpu_seconds_total{group="web"} 0
+# HELP node_process_threads Number of threads.
+# TYPE node_process_threads gauge
+node_process_threads{group="init"} 1
+node_process_threads{group="kernel"} 2
+node_process_threads{group="web"} 0
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, err := parseProcessGroups(test.groups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := newProcessResourceCollector(fs, test.include, test.exclude, false, groups, log.NewNopLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(collectorAdapter{c})
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(test.want),
+				"node_process_count", "node_process_cpu_seconds_total", "node_process_threads"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestProcessResourceCollectorInvalidComm(t *testing.T) {
+	// comm is truncated to 15 bytes, here within the eighth "é".
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "42"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stat := "42 (" + strings.Repeat("é", 7) + "\xc3) S 1 42 42 0 -1 4194304 0 0 0 0 100 34 0 0 20 0 1 0 24 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0"
+	if err := os.WriteFile(filepath.Join(dir, "42", "stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newProcessResourceCollector(fs, ".*", "", false, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+	want := `# HELP node_process_cpu_seconds_total User and system CPU time spent.
+# TYPE node_process_cpu_seconds_total counter
+node_process_cpu_seconds_total{name="ééééééé` + "�" + `",pid="42"} 1.34
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_process_cpu_seconds_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noscript
+// +build !noscript
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go_collector/bin"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	scriptSubsystem = "script"
+	// scriptLabel is added to every metric a script produces. A script label
+	// of the script's own is kept as exportedScriptLabel.
+	scriptLabel         = "script"
+	exportedScriptLabel = "exported_script"
+
+	scriptFormatPrometheus = "prometheus"
+	scriptFormatJSON       = "json"
+)
+
+var (
+	scriptConfigFile = kingpin.Flag("collector.script.config", "JSON file listing the scripts run by the script collector.").Default("").String()
+	scriptTimeout    = kingpin.Flag("collector.script.timeout", "Default timeout of a single script.").Default("10s").Duration()
+)
+
+// scriptConfigEntry is one script in the --collector.script.config file:
+//
+//	{"scripts": [
+//	  {"name": "backup", "command": "/usr/local/bin/check_backup", "args": ["--json"],
+//	   "dir": "/var/backups", "env": {"LANG": "C"}, "timeout": "30s", "format": "json"}
+//	]}
+//
+// "format" is "prometheus" (text exposition format, the default) or "json"
+// (the JSON metrics format, see jsonMetric).
+type scriptConfigEntry struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir"`
+	Env     map[string]string `json:"env"`
+	Timeout string            `json:"timeout"`
+	Format  string            `json:"format"`
+}
+
+type scriptConfig struct {
+	Scripts []scriptConfigEntry `json:"scripts"`
+}
+
+type script struct {
+	name   string
+	format string
+	cmd    bin.Script
+}
+
+type scriptCollector struct {
+	scripts      []script
+	successDesc  *prometheus.Desc
+	durationDesc *prometheus.Desc
+	logger       log.Logger
+}
+
+func init() {
+	registerCollector("script", defaultDisabled, NewScriptCollector)
+}
+
+// NewScriptCollector returns a new Collector exposing the metrics printed by
+// the scripts listed in --collector.script.config.
+func NewScriptCollector(logger log.Logger) (Collector, error) {
+	scripts, err := loadScriptConfig(*scriptConfigFile, *scriptTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newScriptCollector(scripts, logger), nil
+}
+
+func newScriptCollector(scripts []script, logger log.Logger) *scriptCollector {
+	return &scriptCollector{
+		scripts: scripts,
+		successDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, scriptSubsystem, "success"),
+			"Whether the script ran and its output was parsed.",
+			[]string{scriptLabel}, nil,
+		),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, scriptSubsystem, "duration_seconds"),
+			"Duration of the script run.",
+			[]string{scriptLabel}, nil,
+		),
+		logger: logger,
+	}
+}
+
+func loadScriptConfig(path string, defaultTimeout time.Duration) ([]script, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script config: %w", err)
+	}
+	var config scriptConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse script config %q: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	scripts := make([]script, 0, len(config.Scripts))
+	for _, entry := range config.Scripts {
+		if entry.Name == "" || entry.Command == "" {
+			return nil, fmt.Errorf("script config %q: every script needs a name and a command", path)
+		}
+		if seen[entry.Name] {
+			return nil, fmt.Errorf("script config %q: duplicate script %q", path, entry.Name)
+		}
+		seen[entry.Name] = true
+
+		s := script{
+			name:   entry.Name,
+			format: entry.Format,
+			cmd: bin.Script{
+				Path:    entry.Command,
+				Args:    entry.Args,
+				Dir:     entry.Dir,
+				Timeout: defaultTimeout,
+			},
+		}
+		switch s.format {
+		case "":
+			s.format = scriptFormatPrometheus
+		case scriptFormatPrometheus, scriptFormatJSON:
+		default:
+			return nil, fmt.Errorf("script %q: unsupported format %q", entry.Name, entry.Format)
+		}
+		if entry.Timeout != "" {
+			if s.cmd.Timeout, err = time.ParseDuration(entry.Timeout); err != nil {
+				return nil, fmt.Errorf("script %q: invalid timeout: %w", entry.Name, err)
+			}
+		}
+		names := make([]string, 0, len(entry.Env))
+		for k := range entry.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			s.cmd.Env = append(s.cmd.Env, k+"="+entry.Env[k])
+		}
+		scripts = append(scripts, s)
+	}
+	return scripts, nil
+}
+
+type scriptResult struct {
+	families map[string]*dto.MetricFamily
+	duration time.Duration
+	err      error
+}
+
+// Update implements the Collector interface.
+func (c *scriptCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.scripts) == 0 {
+		return ErrNoData
+	}
+
+	results := make([]scriptResult, len(c.scripts))
+	var wg sync.WaitGroup
+	wg.Add(len(c.scripts))
+	for i, s := range c.scripts {
+		go func(i int, s script) {
+			defer wg.Done()
+			begin := time.Now()
+			families, err := runScript(s)
+			results[i] = scriptResult{families: families, duration: time.Since(begin), err: err}
+		}(i, s)
+	}
+	wg.Wait()
+
+	merged := map[string]*dto.MetricFamily{}
+	for i, s := range c.scripts {
+		result := results[i]
+		success := 1.0
+		if result.err != nil {
+			level.Error(c.logger).Log("msg", "script failed", "script", s.name, "err", result.err)
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.successDesc, prometheus.GaugeValue, success, s.name)
+		ch <- prometheus.MustNewConstMetric(c.durationDesc, prometheus.GaugeValue, result.duration.Seconds(), s.name)
+		c.merge(merged, s.name, result.families)
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		convertMetricFamily(merged[name], ch, c.logger)
+	}
+	return nil
+}
+
+// merge labels the families of one script with its name and adds them to
+// merged, so that scripts sharing a metric name end up in one family.
+func (c *scriptCollector) merge(merged map[string]*dto.MetricFamily, name string, families map[string]*dto.MetricFamily) {
+	for metricName, mf := range families {
+		for _, m := range mf.Metric {
+			setScriptLabel(m, name)
+		}
+		existing, ok := merged[metricName]
+		if !ok {
+			if mf.Help == nil {
+				mf.Help = proto.String(fmt.Sprintf("Metric read from script %s.", name))
+			}
+			merged[metricName] = mf
+			continue
+		}
+		if existing.GetType() != mf.GetType() {
+			level.Error(c.logger).Log("msg", "inconsistent metric type across scripts", "metric", metricName, "script", name)
+			continue
+		}
+		existing.Metric = append(existing.Metric, mf.Metric...)
+	}
+}
+
+// setScriptLabel labels m with the name of the script, renaming the script
+// label it already has, as Prometheus does with labels conflicting with
+// target labels.
+func setScriptLabel(m *dto.Metric, name string) {
+	for _, lp := range m.Label {
+		if lp.GetName() == scriptLabel {
+			lp.Name = proto.String(exportedScriptLabel)
+		}
+	}
+	m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(scriptLabel), Value: proto.String(name)})
+}
+
+func runScript(s script) (map[string]*dto.MetricFamily, error) {
+	out, err := bin.RunScript(s.cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var families map[string]*dto.MetricFamily
+	switch s.format {
+	case scriptFormatJSON:
+		families, err = parseJSONMetrics(bytes.NewReader(out))
+	default:
+		var parser expfmt.TextParser
+		families, err = parser.TextToMetricFamilies(bytes.NewReader(out))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output of script %q: %w", s.name, err)
+	}
+	if hasTimestamps(families) {
+		return nil, fmt.Errorf("script %q output contains unsupported client-side timestamps", s.name)
+	}
+	return families, nil
+}
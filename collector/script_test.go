@@ -0,0 +1,145 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noscript
+// +build !noscript
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScriptCollector(t *testing.T) {
+	dir := t.TempDir()
+	prom := writeScript(t, dir, "prom.sh", `cat <<EOT
+# HELP app_queue_depth Jobs waiting.
+# TYPE app_queue_depth gauge
+app_queue_depth{queue="mail"} $QUEUE_DEPTH
+app_queue_depth{queue="sms",script="backup"} 2
+EOT
+`)
+	json := writeScript(t, dir, "json.sh", `echo '[{"name": "app_backup_age_seconds", "type": "gauge", "labels": {"dir": "'$(pwd)'"}, "value": 60}]'`)
+	slow := writeScript(t, dir, "slow.sh", "sleep 5\n")
+	config := filepath.Join(dir, "scripts.json")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(`{"scripts": [
+		{"name": "queue", "command": %q, "env": {"QUEUE_DEPTH": "7"}},
+		{"name": "backup", "command": %q, "dir": %q, "format": "json"},
+		{"name": "slow", "command": %q, "timeout": "100ms"}
+	]}`, prom, json, dir, slow)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := loadScriptConfig(config, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{newScriptCollector(scripts, log.NewNopLogger())})
+
+	want := fmt.Sprintf(`# HELP app_backup_age_seconds Metric read from script backup.
+# TYPE app_backup_age_seconds gauge
+app_backup_age_seconds{dir=%q,script="backup"} 60
+# HELP app_queue_depth Jobs waiting.
+# TYPE app_queue_depth gauge
+app_queue_depth{exported_script="",queue="mail",script="queue"} 7
+app_queue_depth{exported_script="backup",queue="sms",script="queue"} 2
+# HELP node_script_success Whether the script ran and its output was parsed.
+# TYPE node_script_success gauge
+node_script_success{script="backup"} 1
+node_script_success{script="queue"} 1
+node_script_success{script="slow"} 0
+`, dir)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "app_backup_age_seconds", "app_queue_depth", "node_script_success"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadScriptConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing command":   `{"scripts": [{"name": "a"}]}`,
+		"duplicate name":    `{"scripts": [{"name": "a", "command": "x"}, {"name": "a", "command": "y"}]}`,
+		"bad format":        `{"scripts": [{"name": "a", "command": "x", "format": "xml"}]}`,
+		"bad timeout":       `{"scripts": [{"name": "a", "command": "x", "timeout": "soon"}]}`,
+		"unknown field":     `{"scripts": [{"name": "a", "command": "x", "user": "root"}]}`,
+		"not a JSON object": `scripts: []`,
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scripts.json")
+			if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadScriptConfig(path, time.Second); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseJSONMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		metrics int
+		err     bool
+	}{
+		{name: "gauge and counter", input: `[{"name": "a", "type": "gauge", "value": 1}, {"name": "b_total", "type": "counter", "labels": {"x": "y"}, "value": 2}]`, metrics: 2},
+		{name: "grouped", input: `[{"name": "a", "labels": {"x": "1"}, "value": 1}, {"name": "a", "labels": {"x": "2"}, "value": 2}]`, metrics: 2},
+		{name: "empty", input: `[]`},
+		{name: "invalid name", input: `[{"name": "1a", "value": 1}]`, err: true},
+		{name: "invalid label", input: `[{"name": "a", "labels": {"a-b": "c"}, "value": 1}]`, err: true},
+		{name: "missing value", input: `[{"name": "a"}]`, err: true},
+		{name: "unknown type", input: `[{"name": "a", "type": "histogram", "value": 1}]`, err: true},
+		{name: "type conflict", input: `[{"name": "a", "type": "gauge", "value": 1}, {"name": "a", "type": "counter", "value": 1}]`, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			families, err := parseJSONMetrics(strings.NewReader(test.input))
+			if test.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got int
+			for _, mf := range families {
+				got += len(mf.Metric)
+			}
+			if got != test.metrics {
+				t.Errorf("expected %d metrics, got %d", test.metrics, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosockets
+// +build !nosockets
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	socketsSubsystem = "sockets"
+
+	// Socket states, as in tcpConnectionState. Unconnected UDP sockets are
+	// reported in the TCP_CLOSE state.
+	socketEstablished = 1
+	socketClose       = 7
+	socketListen      = 10
+)
+
+// socketOwner is the process holding a socket.
+type socketOwner struct {
+	pid  string
+	comm string
+}
+
+// socketProtocol is a family and protocol pair dumped with inet_diag.
+type socketProtocol struct {
+	name     string
+	family   uint8
+	protocol uint8
+	// states are the listening states, 1<<state.
+	states uint32
+}
+
+var socketProtocols = []socketProtocol{
+	{"tcp", syscall.AF_INET, syscall.IPPROTO_TCP, 1 << socketListen},
+	{"tcp6", syscall.AF_INET6, syscall.IPPROTO_TCP, 1 << socketListen},
+	{"udp", syscall.AF_INET, syscall.IPPROTO_UDP, 1 << socketClose},
+	{"udp6", syscall.AF_INET6, syscall.IPPROTO_UDP, 1 << socketClose},
+}
+
+type socketsCollector struct {
+	fs procfs.FS
+	// dump returns the inet_diag messages of the sockets in the states.
+	dump func(family, protocol uint8, states uint32) ([]netlink.Message, error)
+
+	listening   *prometheus.Desc
+	established *prometheus.Desc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector(socketsSubsystem, defaultDisabled, NewSocketsCollector)
+}
+
+// NewSocketsCollector returns a new Collector listing the listening sockets
+// and counting the established TCP connections per peer.
+func NewSocketsCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	return newSocketsCollector(fs, inetDiagDump, logger), nil
+}
+
+func newSocketsCollector(fs procfs.FS, dump func(family, protocol uint8, states uint32) ([]netlink.Message, error), logger log.Logger) *socketsCollector {
+	return &socketsCollector{
+		fs:   fs,
+		dump: dump,
+		listening: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, socketsSubsystem, "listening"),
+			"Listening TCP socket or unconnected UDP socket, with the process holding it when known.",
+			[]string{"protocol", "address", "port", "process", "pid"}, nil,
+		),
+		established: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, socketsSubsystem, "established_connections"),
+			"Established TCP connections per peer. Inbound connections are counted per local port, outbound ones per remote port.",
+			[]string{"direction", "remote_address", "port"}, nil,
+		),
+		logger: logger,
+	}
+}
+
+type listeningSocket struct {
+	protocol string
+	address  string
+	port     uint16
+	inode    uint32
+}
+
+type connectionKey struct {
+	direction string
+	remote    string
+	port      uint16
+}
+
+// Update implements the Collector interface.
+func (c *socketsCollector) Update(ch chan<- prometheus.Metric) error {
+	var listeners []listeningSocket
+	listenPorts := map[uint16]bool{}
+	for _, p := range socketProtocols {
+		if p.family == syscall.AF_INET6 {
+			if _, err := os.Stat(procFilePath("net/" + p.name)); err != nil {
+				continue
+			}
+		}
+		msgs, err := c.dump(p.family, p.protocol, p.states)
+		if err != nil {
+			return fmt.Errorf("couldn't get %s sockets: %w", p.name, err)
+		}
+		for _, m := range msgs {
+			msg := parseInetDiagMsg(m.Data)
+			l := listeningSocket{
+				protocol: p.name,
+				address:  inetDiagIP(msg.Family, msg.ID.SourceIP).String(),
+				port:     binary.BigEndian.Uint16(msg.ID.SourcePort[:]),
+				inode:    msg.Inode,
+			}
+			listeners = append(listeners, l)
+			if p.protocol == syscall.IPPROTO_TCP {
+				listenPorts[l.port] = true
+			}
+		}
+	}
+
+	connections := map[connectionKey]float64{}
+	for _, p := range socketProtocols {
+		if p.protocol != syscall.IPPROTO_TCP {
+			continue
+		}
+		if p.family == syscall.AF_INET6 {
+			if _, err := os.Stat(procFilePath("net/" + p.name)); err != nil {
+				continue
+			}
+		}
+		msgs, err := c.dump(p.family, p.protocol, 1<<socketEstablished)
+		if err != nil {
+			return fmt.Errorf("couldn't get %s connections: %w", p.name, err)
+		}
+		for key, count := range aggregateConnections(msgs, listenPorts) {
+			connections[key] += count
+		}
+	}
+
+	owners := c.socketOwners()
+	seen := map[string]bool{}
+	for _, l := range listeners {
+		owner := owners[l.inode]
+		labels := []string{l.protocol, l.address, strconv.Itoa(int(l.port)), owner.comm, owner.pid}
+		// Sockets sharing a port with SO_REUSEPORT are reported once.
+		if key := strings.Join(labels, "\x00"); !seen[key] {
+			seen[key] = true
+			ch <- prometheus.MustNewConstMetric(c.listening, prometheus.GaugeValue, 1, labels...)
+		}
+	}
+	for key, count := range connections {
+		ch <- prometheus.MustNewConstMetric(c.established, prometheus.GaugeValue, count,
+			key.direction, key.remote, strconv.Itoa(int(key.port)))
+	}
+	return nil
+}
+
+// aggregateConnections counts connections to a local listening port as
+// inbound, per remote address and local port, and the others as outbound,
+// per remote address and port. This keeps ephemeral ports out of the labels.
+func aggregateConnections(msgs []netlink.Message, listenPorts map[uint16]bool) map[connectionKey]float64 {
+	connections := map[connectionKey]float64{}
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		remote := inetDiagIP(msg.Family, msg.ID.DestIP).String()
+		localPort := binary.BigEndian.Uint16(msg.ID.SourcePort[:])
+		key := connectionKey{direction: "outbound", remote: remote, port: binary.BigEndian.Uint16(msg.ID.DestPort[:])}
+		if listenPorts[localPort] {
+			key = connectionKey{direction: "inbound", remote: remote, port: localPort}
+		}
+		connections[key]++
+	}
+	return connections
+}
+
+func inetDiagIP(family uint8, addr [4][4]byte) net.IP {
+	if family == syscall.AF_INET {
+		return net.IP(addr[0][:]).To4()
+	}
+	ip := make(net.IP, 0, net.IPv6len)
+	for _, word := range addr {
+		ip = append(ip, word[:]...)
+	}
+	return ip
+}
+
+// socketOwners maps socket inodes to the process holding them. Without
+// privileges only the sockets of the agent's own user are found.
+func (c *socketsCollector) socketOwners() map[uint32]socketOwner {
+	owners := map[uint32]socketOwner{}
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "unable to list processes", "err", err)
+		return owners
+	}
+	for _, p := range procs {
+		targets, err := p.FileDescriptorTargets()
+		if err != nil {
+			continue
+		}
+		var owner *socketOwner
+		for _, target := range targets {
+			inode, ok := strings.CutPrefix(target, "socket:[")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 32)
+			if err != nil {
+				continue
+			}
+			if owner == nil {
+				comm, _ := p.Comm()
+				owner = &socketOwner{pid: strconv.Itoa(p.PID), comm: strings.ToValidUTF8(comm, "\uFFFD")}
+			}
+			if _, ok := owners[uint32(n)]; !ok {
+				owners[uint32(n)] = *owner
+			}
+		}
+	}
+	return owners
+}
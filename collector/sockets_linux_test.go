@@ -0,0 +1,135 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosockets
+// +build !nosockets
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+func encodeInetDiagMsg(family uint8, src [4]byte, srcPort uint16, dst [4]byte, dstPort uint16, inode uint32) netlink.Message {
+	m := InetDiagMsg{Family: family, Inode: inode}
+	binary.BigEndian.PutUint16(m.ID.SourcePort[:], srcPort)
+	binary.BigEndian.PutUint16(m.ID.DestPort[:], dstPort)
+	m.ID.SourceIP[0], m.ID.DestIP[0] = src, dst
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, native.Endian, m); err != nil {
+		panic(err)
+	}
+	return netlink.Message{Data: buf.Bytes()}
+}
+
+func TestSocketsCollector(t *testing.T) {
+	// A procfs with IPv4 only, one process holding the SSH listener and one,
+	// whose name is not valid UTF-8, holding the DNS socket.
+	proc := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(proc, "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for pid, p := range map[string]struct{ comm, socket string }{
+		"812": {"sshd\n", "socket:[1001]"},
+		"813": {"\xffdns\n", "socket:[1004]"},
+	} {
+		if err := os.MkdirAll(filepath.Join(proc, pid, "fd"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(proc, pid, "comm"), []byte(p.comm), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(p.socket, filepath.Join(proc, pid, "fd", "3")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(path string) { *procPath = path }(*procPath)
+	*procPath = proc
+	fs, err := procfs.NewFS(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	any4, local, peer, db := [4]byte{}, [4]byte{10, 0, 0, 5}, [4]byte{10, 0, 0, 9}, [4]byte{10, 0, 1, 2}
+	dump := func(family, protocol uint8, states uint32) ([]netlink.Message, error) {
+		if family != syscall.AF_INET {
+			t.Errorf("unexpected dump of family %d", family)
+			return nil, nil
+		}
+		switch {
+		case protocol == syscall.IPPROTO_TCP && states == 1<<socketListen:
+			return []netlink.Message{
+				encodeInetDiagMsg(family, any4, 22, any4, 0, 1001),
+				// SO_REUSEPORT listeners share the address and port.
+				encodeInetDiagMsg(family, local, 8080, any4, 0, 1002),
+				encodeInetDiagMsg(family, local, 8080, any4, 0, 1003),
+			}, nil
+		case protocol == syscall.IPPROTO_UDP && states == 1<<socketClose:
+			return []netlink.Message{encodeInetDiagMsg(family, any4, 53, any4, 0, 1004)}, nil
+		case protocol == syscall.IPPROTO_TCP && states == 1<<socketEstablished:
+			return []netlink.Message{
+				encodeInetDiagMsg(family, local, 22, peer, 51000, 0),
+				encodeInetDiagMsg(family, local, 22, peer, 51001, 0),
+				encodeInetDiagMsg(family, local, 43210, db, 5432, 0),
+				encodeInetDiagMsg(family, local, 43211, db, 5432, 0),
+				encodeInetDiagMsg(family, local, 43212, db, 5432, 0),
+			}, nil
+		}
+		t.Errorf("unexpected dump of protocol %d in states %#x", protocol, states)
+		return nil, nil
+	}
+
+	c := newSocketsCollector(fs, dump, log.NewNopLogger())
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+
+	want := `# HELP node_sockets_established_connections Established TCP connections per peer. Inbound connections are counted per local port, outbound ones per remote port.
+# TYPE node_sockets_established_connections gauge
+node_sockets_established_connections{direction="inbound",port="22",remote_address="10.0.0.9"} 2
+node_sockets_established_connections{direction="outbound",port="5432",remote_address="10.0.1.2"} 3
+# HELP node_sockets_listening Listening TCP socket or unconnected UDP socket, with the process holding it when known.
+# TYPE node_sockets_listening gauge
+node_sockets_listening{address="0.0.0.0",pid="813",port="53",process="�dns",protocol="udp"} 1
+node_sockets_listening{address="0.0.0.0",pid="812",port="22",process="sshd",protocol="tcp"} 1
+node_sockets_listening{address="10.0.0.5",pid="",port="8080",process="",protocol="tcp"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInetDiagIP(t *testing.T) {
+	var addr [4][4]byte
+	addr[0] = [4]byte{0x20, 0x01, 0x0d, 0xb8}
+	addr[3] = [4]byte{0, 0, 0, 1}
+	if got, want := inetDiagIP(syscall.AF_INET6, addr).String(), "2001:db8::1"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if got, want := inetDiagIP(syscall.AF_INET, addr).String(), "32.1.13.184"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
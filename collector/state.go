@@ -0,0 +1,66 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_collector/utils"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// stateDirectory holds what collectors need to remember between the single
+// runs of the agent, such as how far a log file has been read.
+var stateDirectory = kingpin.Flag("collector.state.directory", "Directory where collectors persist their state between runs, relative to the directory of the executable.").Default("state").String()
+
+func stateFilePath(name string) string {
+	return filepath.Join(utils.ExeRelative(*stateDirectory), name)
+}
+
+// loadState decodes the JSON state file at path into v. A missing file
+// leaves v untouched and is not an error.
+func loadState(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state file %q: %w", path, err)
+	}
+	return nil
+}
+
+// saveState writes v as JSON to path, replacing the previous state
+// atomically so that an interrupted run does not leave a truncated file.
+func saveState(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
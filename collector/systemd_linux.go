@@ -64,6 +64,8 @@ var (
 
 type systemdCollector struct {
 	unitDesc                      *prometheus.Desc
+	unitSubStateDesc              *prometheus.Desc
+	unitFailedSinceDesc           *prometheus.Desc
 	unitStartTimeDesc             *prometheus.Desc
 	unitTasksCurrentDesc          *prometheus.Desc
 	unitTasksMaxDesc              *prometheus.Desc
@@ -95,6 +97,14 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 		prometheus.BuildFQName(namespace, subsystem, "unit_state"),
 		"Systemd unit", []string{"name", "state", "type"}, nil,
 	)
+	unitSubStateDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "unit_sub_state"),
+		"Systemd unit low-level state, such as running or exited", []string{"name", "sub_state"}, nil,
+	)
+	unitFailedSinceDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "unit_failed_since_seconds"),
+		"Time the failed unit entered the failed state since unix epoch in seconds.", []string{"name"}, nil,
+	)
 	unitStartTimeDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "unit_start_time_seconds"),
 		"Start time of the unit since unix epoch in seconds.", []string{"name"}, nil,
@@ -157,6 +167,8 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 
 	return &systemdCollector{
 		unitDesc:                      unitDesc,
+		unitSubStateDesc:              unitSubStateDesc,
+		unitFailedSinceDesc:           unitFailedSinceDesc,
 		unitStartTimeDesc:             unitStartTimeDesc,
 		unitTasksCurrentDesc:          unitTasksCurrentDesc,
 		unitTasksMaxDesc:              unitTasksMaxDesc,
@@ -295,6 +307,19 @@ func (c *systemdCollector) collectUnitStatusMetrics(conn *dbus.Conn, ch chan<- p
 				c.unitDesc, prometheus.GaugeValue, isActive,
 				unit.Name, stateName, serviceType)
 		}
+		ch <- prometheus.MustNewConstMetric(
+			c.unitSubStateDesc, prometheus.GaugeValue, 1,
+			unit.Name, unit.SubState)
+		if unit.ActiveState == "failed" {
+			stateChange, err := conn.GetUnitPropertyContext(context.TODO(), unit.Name, "StateChangeTimestamp")
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't get unit StateChangeTimestamp", "unit", unit.Name, "err", err)
+			} else {
+				ch <- prometheus.MustNewConstMetric(
+					c.unitFailedSinceDesc, prometheus.GaugeValue,
+					float64(stateChange.Value.Value().(uint64))/1e6, unit.Name)
+			}
+		}
 		if *enableRestartsMetrics && strings.HasSuffix(unit.Name, ".service") {
 			// NRestarts wasn't added until systemd 235.
 			restartsCount, err := conn.GetUnitTypePropertyContext(context.TODO(), unit.Name, "Service", "NRestarts")
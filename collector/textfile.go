@@ -17,7 +17,9 @@
 package collector
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -34,16 +36,32 @@ import (
 
 var (
 	textFileDirectory = kingpin.Flag("collector.textfile.directory", "Directory to read text files with metrics from.").Default("").String()
+	textFileMaxAge    = kingpin.Flag("collector.textfile.max-age", "Ignore the metrics of text files not modified for this long, 0 disables the check.").Default("0s").Duration()
 	mtimeDesc         = prometheus.NewDesc(
 		"node_textfile_mtime_seconds",
 		"Unixtime mtime of textfiles successfully read.",
 		[]string{"file"},
 		nil,
 	)
+	staleDesc = prometheus.NewDesc(
+		"node_textfile_stale",
+		"1 if the metrics of a textfile were ignored because it is older than --collector.textfile.max-age, 0 otherwise.",
+		[]string{"file"},
+		nil,
+	)
+)
+
+// Suffixes of the files read by the textfile collector. Files ending in
+// ".prom" are read as OpenMetrics when their last line is "# EOF".
+const (
+	textFileSuffixProm        = ".prom"
+	textFileSuffixOpenMetrics = ".om"
+	textFileSuffixJSON        = ".json"
 )
 
 type textFileCollector struct {
-	path string
+	path   string
+	maxAge time.Duration
 	// Only set for testing to get predictable output.
 	mtime  *float64
 	logger log.Logger
@@ -58,112 +76,12 @@ func init() {
 func NewTextFileCollector(logger log.Logger) (Collector, error) {
 	c := &textFileCollector{
 		path:   *textFileDirectory,
+		maxAge: *textFileMaxAge,
 		logger: logger,
 	}
 	return c, nil
 }
 
-func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Metric, logger log.Logger) {
-	var valType prometheus.ValueType
-	var val float64
-
-	allLabelNames := map[string]struct{}{}
-	for _, metric := range metricFamily.Metric {
-		labels := metric.GetLabel()
-		for _, label := range labels {
-			if _, ok := allLabelNames[label.GetName()]; !ok {
-				allLabelNames[label.GetName()] = struct{}{}
-			}
-		}
-	}
-
-	for _, metric := range metricFamily.Metric {
-		if metric.TimestampMs != nil {
-			level.Warn(logger).Log("msg", "Ignoring unsupported custom timestamp on textfile collector metric", "metric", metric)
-		}
-
-		labels := metric.GetLabel()
-		var names []string
-		var values []string
-		for _, label := range labels {
-			names = append(names, label.GetName())
-			values = append(values, label.GetValue())
-		}
-
-		for k := range allLabelNames {
-			present := false
-			for _, name := range names {
-				if k == name {
-					present = true
-					break
-				}
-			}
-			if !present {
-				names = append(names, k)
-				values = append(values, "")
-			}
-		}
-
-		metricType := metricFamily.GetType()
-		switch metricType {
-		case dto.MetricType_COUNTER:
-			valType = prometheus.CounterValue
-			val = metric.Counter.GetValue()
-
-		case dto.MetricType_GAUGE:
-			valType = prometheus.GaugeValue
-			val = metric.Gauge.GetValue()
-
-		case dto.MetricType_UNTYPED:
-			valType = prometheus.UntypedValue
-			val = metric.Untyped.GetValue()
-
-		case dto.MetricType_SUMMARY:
-			quantiles := map[float64]float64{}
-			for _, q := range metric.Summary.Quantile {
-				quantiles[q.GetQuantile()] = q.GetValue()
-			}
-			ch <- prometheus.MustNewConstSummary(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				metric.Summary.GetSampleCount(),
-				metric.Summary.GetSampleSum(),
-				quantiles, values...,
-			)
-		case dto.MetricType_HISTOGRAM:
-			buckets := map[float64]uint64{}
-			for _, b := range metric.Histogram.Bucket {
-				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
-			}
-			ch <- prometheus.MustNewConstHistogram(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				metric.Histogram.GetSampleCount(),
-				metric.Histogram.GetSampleSum(),
-				buckets, values...,
-			)
-		default:
-			panic("unknown metric type")
-		}
-		if metricType == dto.MetricType_GAUGE || metricType == dto.MetricType_COUNTER || metricType == dto.MetricType_UNTYPED {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				valType, val, values...,
-			)
-		}
-	}
-}
-
 func (c *textFileCollector) exportMTimes(mtimes map[string]time.Time, ch chan<- prometheus.Metric) {
 	if len(mtimes) == 0 {
 		return
@@ -186,6 +104,22 @@ func (c *textFileCollector) exportMTimes(mtimes map[string]time.Time, ch chan<-
 	}
 }
 
+func exportStale(stale map[string]bool, ch chan<- prometheus.Metric) {
+	filepaths := make([]string, 0, len(stale))
+	for path := range stale {
+		filepaths = append(filepaths, path)
+	}
+	sort.Strings(filepaths)
+
+	for _, path := range filepaths {
+		var v float64
+		if stale[path] {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(staleDesc, prometheus.GaugeValue, v, path)
+	}
+}
+
 // Update implements the Collector interface.
 func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	// Iterate over files and accumulate their metrics, but also track any
@@ -203,6 +137,7 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	mtimes := make(map[string]time.Time)
+	stale := make(map[string]bool)
 	for _, path := range paths {
 		files, err := os.ReadDir(path)
 		if err != nil && path != "" {
@@ -212,11 +147,20 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 
 		for _, f := range files {
 			metricsFilePath := filepath.Join(path, f.Name())
-			if !strings.HasSuffix(f.Name(), ".prom") {
+			if !isTextFile(f.Name()) {
 				continue
 			}
 
 			mtime, families, err := c.processFile(path, f.Name(), ch)
+			if err == nil && c.maxAge > 0 {
+				if age := time.Since(*mtime); age > c.maxAge {
+					level.Warn(c.logger).Log("msg", "ignoring stale textfile", "file", metricsFilePath, "age", age)
+					stale[metricsFilePath] = true
+					families = nil
+				} else {
+					stale[metricsFilePath] = false
+				}
+			}
 
 			for _, mf := range families {
 				// Check for metrics with inconsistent help texts and take the first help text occurrence.
@@ -262,6 +206,7 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	c.exportMTimes(mtimes, ch)
+	exportStale(stale, ch)
 
 	// Export if there were errors.
 	var errVal float64
@@ -290,8 +235,11 @@ func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.M
 	}
 	defer f.Close()
 
-	var parser expfmt.TextParser
-	families, err := parser.TextToMetricFamilies(f)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read textfile data file %q: %w", path, err)
+	}
+	families, err := parseTextFile(name, data)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse textfile data from %q: %w", path, err)
 	}
@@ -311,14 +259,24 @@ func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.M
 	return &t, families, nil
 }
 
-// hasTimestamps returns true when metrics contain unsupported timestamps.
-func hasTimestamps(parsedFamilies map[string]*dto.MetricFamily) bool {
-	for _, mf := range parsedFamilies {
-		for _, m := range mf.Metric {
-			if m.TimestampMs != nil {
-				return true
-			}
+func isTextFile(name string) bool {
+	return strings.HasSuffix(name, textFileSuffixProm) ||
+		strings.HasSuffix(name, textFileSuffixOpenMetrics) ||
+		strings.HasSuffix(name, textFileSuffixJSON)
+}
+
+// parseTextFile parses data according to the format implied by the file name.
+func parseTextFile(name string, data []byte) (map[string]*dto.MetricFamily, error) {
+	if strings.HasSuffix(name, textFileSuffixJSON) {
+		return parseJSONMetrics(bytes.NewReader(data))
+	}
+	if strings.HasSuffix(name, textFileSuffixOpenMetrics) || isOpenMetrics(data) {
+		converted, err := openMetricsToText(data)
+		if err != nil {
+			return nil, err
 		}
+		data = converted
 	}
-	return false
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(bytes.NewReader(data))
 }
@@ -21,12 +21,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 )
@@ -114,6 +118,18 @@ func TestTextfileCollector(t *testing.T) {
 			path: "fixtures/textfile/metrics_merge_different_help",
 			out:  "fixtures/textfile/metrics_merge_different_help.out",
 		},
+		{
+			path: "fixtures/textfile/openmetrics",
+			out:  "fixtures/textfile/openmetrics.out",
+		},
+		{
+			path: "fixtures/textfile/openmetrics_truncated",
+			out:  "fixtures/textfile/openmetrics_truncated.out",
+		},
+		{
+			path: "fixtures/textfile/json",
+			out:  "fixtures/textfile/json.out",
+		},
 	}
 
 	for i, test := range tests {
@@ -149,3 +165,41 @@ func TestTextfileCollector(t *testing.T) {
 		}
 	}
 }
+
+func TestTextfileCollectorMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"fresh.prom": "fresh_metric 1\n",
+		"stale.prom": "stale_metric 1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "stale.prom"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := 1.0
+	c := &textFileCollector{
+		path:   dir,
+		maxAge: time.Hour,
+		mtime:  &mtime,
+		logger: log.NewNopLogger(),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+
+	want := fmt.Sprintf(`# HELP fresh_metric Metric read from %[1]s/fresh.prom
+# TYPE fresh_metric untyped
+fresh_metric 1
+# HELP node_textfile_stale 1 if the metrics of a textfile were ignored because it is older than --collector.textfile.max-age, 0 otherwise.
+# TYPE node_textfile_stale gauge
+node_textfile_stale{file="%[1]s/fresh.prom"} 0
+node_textfile_stale{file="%[1]s/stale.prom"} 1
+`, dir)
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "fresh_metric", "stale_metric", "node_textfile_stale"); err != nil {
+		t.Error(err)
+	}
+}
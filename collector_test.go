@@ -1,58 +1,84 @@
 package main
 
 import (
-	"bytes"
-	"io"
+	"encoding/json"
+	"flag"
+	"go_collector/bin"
+	"go_collector/collector"
+	"go_collector/handle"
+	"go_collector/utils/ttar"
 	"os"
-	"strings"
+	"path/filepath"
 	"testing"
-	"time"
-)
 
-func TestTimedMainExecution(t *testing.T) {
-	// 设置执行间隔
-	interval := 2 * time.Second
-	// 设置执行次数
-	executions := 3
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
 
-	// 捕获标准输出
-	oldStdout := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+var update = flag.Bool("update", false, "Rewrite collector/fixtures/payload.json with the payload collected.")
 
-	for i := 0; i < executions; i++ {
-		start := time.Now()
-		main()
-		time.Sleep(interval - time.Since(start))
+// fixtures assembles the snapshot in collector/fixtures, extracting the
+// archived sys and udev trees, in a temporary directory.
+func fixtures(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, archive := range []string{"sys.ttar", "udev.ttar"} {
+		f, err := os.Open(filepath.Join("collector/fixtures", archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ttar.Extract(f, dir)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
+	for _, name := range []string{"proc", "commands"} {
+		target, err := filepath.Abs(filepath.Join("collector/fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
 
-	// 恢复标准输出
-	w.Close()
-	os.Stdout = oldStdout
-
-	var buf bytes.Buffer
-	io.Copy(&buf, r)
-	output := buf.String()
-
-	// 验证输出
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if len(lines) != executions {
-		t.Errorf("Expected %d lines of output, got %d", executions, len(lines))
+func TestFixturesPayload(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
 	}
+	dir := fixtures(t)
+	collector.UseFixtures(dir)
+	bin.Replay(filepath.Join(dir, "commands"))
 
-	for i, line := range lines {
-		if !strings.Contains(line, "Main function executed at:") {
-			t.Errorf("Line %d does not contain expected output", i+1)
-		}
+	logger := log.NewNopLogger()
+	nc, err := collector.NewNodeCollector(logger, append(filters, handle.Collectors()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := collect(logger, nc, true)
+	if err != nil {
+		t.Fatal(err)
 	}
+	got, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
 
-	// 验证执行间隔
-	for i := 1; i < len(lines); i++ {
-		t1, _ := time.Parse(time.RFC3339, strings.TrimPrefix(lines[i-1], "Main function executed at: "))
-		t2, _ := time.Parse(time.RFC3339, strings.TrimPrefix(lines[i], "Main function executed at: "))
-		actualInterval := t2.Sub(t1)
-		if actualInterval < interval-100*time.Millisecond || actualInterval > interval+100*time.Millisecond {
-			t.Errorf("Interval between execution %d and %d was %v, expected about %v", i, i+1, actualInterval, interval)
+	golden := "collector/fixtures/payload.json"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
 		}
 	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("payload differs from %s, run with -update to accept it:\n%s", golden, got)
+	}
 }
@@ -0,0 +1,359 @@
+// Package config fetches the agent configuration served alongside HOST and
+// applies it to the command line flags.
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_collector/collector"
+	"go_collector/handle"
+	"go_collector/utils"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// maxConfigBytes bounds the size of a served configuration.
+const maxConfigBytes = 1 << 20
+
+var (
+	url = kingpin.Flag(
+		"config.url",
+		"URL the configuration is fetched from at startup. Flags given on the command line take precedence over it.",
+	).Envar("CONFIG_URL").Default("").String()
+	cacheFile = kingpin.Flag(
+		"config.cache-file",
+		"File the last valid configuration fetched from --config.url is kept in, used when the server cannot be reached. Relative to the directory of the executable.",
+	).Default("remote_config.json").String()
+	insecureSkipVerify = kingpin.Flag(
+		"config.insecure-skip-verify",
+		"Do not verify the certificate of --config.url.",
+	).Default("false").Bool()
+	timeout = kingpin.Flag(
+		"config.timeout",
+		"Timeout of the request fetching the configuration.",
+	).Default("10s").Duration()
+)
+
+// Config is the configuration served by --config.url. Fields left out keep
+// the values of the flags.
+type Config struct {
+	// Collectors are the collectors run, besides those the enabled handle
+	// modules depend on.
+	Collectors []string `json:"collectors,omitempty"`
+	// Modules enables or disables handle modules by name.
+	Modules map[string]bool `json:"modules,omitempty"`
+	// Interval is the --handle.rate-interval, e.g. "2s".
+	Interval string `json:"interval,omitempty"`
+	// Filters sets include and exclude regular expressions of collectors,
+	// keyed by flag name, e.g. "collector.netdev.device-exclude".
+	Filters map[string]string `json:"filters,omitempty"`
+}
+
+// Parse decodes and validates a configuration against the flags of app.
+// Unknown fields are an error.
+func Parse(app *kingpin.Application, b []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := c.validate(app); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return &c, nil
+}
+
+func (c *Config) validate(app *kingpin.Application) error {
+	for _, name := range c.Collectors {
+		if !collector.Registered(name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	for name, enabled := range c.Modules {
+		if !handle.Registered(name) {
+			return fmt.Errorf("unknown handle module %q", name)
+		}
+		if !enabled && isRequired(name) {
+			return fmt.Errorf("handle module %q is required", name)
+		}
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("interval %q is not a positive duration", c.Interval)
+		}
+	}
+	for name, re := range c.Filters {
+		if !strings.HasPrefix(name, "collector.") || !(strings.HasSuffix(name, "include") || strings.HasSuffix(name, "exclude")) {
+			return fmt.Errorf("%s is not an include or exclude flag", name)
+		}
+		flag := app.GetFlag(name)
+		if flag == nil {
+			return fmt.Errorf("unknown flag %s", name)
+		}
+		model := flag.Model()
+		if r, ok := model.Value.(interface{ IsCumulative() bool }); model.IsBoolFlag() || ok && r.IsCumulative() {
+			return fmt.Errorf("%s does not take a regular expression", name)
+		}
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Apply sets the flags of app from c, except those in explicit, and returns
+// the collectors to run, nil when c leaves them to the caller. Collectors,
+// and those of the enabled modules, are enabled unless disabled on the
+// command line; a module whose collectors are is left as it is.
+func (c *Config) Apply(app *kingpin.Application, explicit map[string]bool) ([]string, error) {
+	set := func(name, value string) error {
+		if explicit[name] {
+			return nil
+		}
+		if err := app.GetFlag(name).Model().Value.Set(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+
+	var collectors []string
+	for _, name := range c.Collectors {
+		if err := set("collector."+name, "true"); err != nil {
+			return nil, err
+		}
+		if app.GetFlag("collector."+name).Model().String() == "true" {
+			collectors = append(collectors, name)
+		}
+	}
+	if c.Collectors != nil && collectors == nil {
+		collectors = []string{}
+	}
+	for _, name := range sortedKeys(c.Modules) {
+		if !c.Modules[name] {
+			if err := set("handle."+name, "false"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// A module runs only along with its collectors, which may be
+		// disabled by default: enable them too, unless one was disabled
+		// on the command line.
+		deps := handle.ModuleCollectors(name)
+		disabled := false
+		for _, dep := range deps {
+			flag := "collector." + dep
+			disabled = disabled || explicit[flag] && app.GetFlag(flag).Model().String() != "true"
+		}
+		if disabled {
+			continue
+		}
+		if err := set("handle."+name, "true"); err != nil {
+			return nil, err
+		}
+		if app.GetFlag("handle."+name).Model().String() != "true" {
+			continue
+		}
+		for _, dep := range deps {
+			if err := set("collector."+dep, "true"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.Interval != "" {
+		if err := set("handle.rate-interval", c.Interval); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range sortedKeys(c.Filters) {
+		if err := set(name, c.Filters[name]); err != nil {
+			return nil, err
+		}
+	}
+	return collectors, nil
+}
+
+func isRequired(module string) bool {
+	for _, name := range handle.RequiredSections {
+		if name == module {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Explicit returns the names of the flags of app given in args.
+func Explicit(app *kingpin.Application, args []string) map[string]bool {
+	explicit := map[string]bool{}
+	ctx, err := app.ParseContext(args)
+	if err != nil {
+		return explicit
+	}
+	for _, el := range ctx.Elements {
+		if flag, ok := el.Clause.(*kingpin.FlagClause); ok {
+			explicit[flag.Model().Name] = true
+		}
+	}
+	return explicit
+}
+
+// cache is the content of the cache file.
+type cache struct {
+	ETag   string          `json:"etag,omitempty"`
+	Config json.RawMessage `json:"config"`
+}
+
+// Fetcher fetches the configuration from URL, keeping the last valid one
+// in CacheFile.
+type Fetcher struct {
+	URL       string
+	CacheFile string
+	Client    *http.Client
+	App       *kingpin.Application
+}
+
+// NewFetcher returns a Fetcher configured by the --config.* flags, nil
+// when --config.url is not set.
+func NewFetcher(app *kingpin.Application) *Fetcher {
+	if *url == "" {
+		return nil
+	}
+	return &Fetcher{
+		URL:       *url,
+		CacheFile: utils.ExeRelative(*cacheFile),
+		Client: &http.Client{
+			Timeout:   *timeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecureSkipVerify}},
+		},
+		App: app,
+	}
+}
+
+// Fetch returns the configuration served at URL, revalidating the cached
+// copy with its ETag. When the server cannot be reached, answers an error
+// or serves an invalid configuration, the cached copy is returned with
+// cached set, along with the error; the returned configuration is nil when
+// there is no valid cached copy either. A configuration fetched but not
+// cached is returned along with the error too.
+func (f *Fetcher) Fetch(ctx context.Context) (cfg *Config, cached bool, err error) {
+	c, cacheErr := f.loadCache()
+	cfg, err = f.fetch(ctx, c)
+	if err == nil || cfg != nil {
+		return cfg, false, err
+	}
+	if cacheErr != nil {
+		return nil, false, errors.Join(err, cacheErr)
+	}
+	if c == nil {
+		return nil, false, err
+	}
+	return c.config, true, err
+}
+
+type cachedConfig struct {
+	etag   string
+	config *Config
+}
+
+// loadCache returns the cached configuration, nil when there is none.
+func (f *Fetcher) loadCache() (*cachedConfig, error) {
+	b, err := os.ReadFile(f.CacheFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c cache
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cache %s: %w", f.CacheFile, err)
+	}
+	cfg, err := Parse(f.App, c.Config)
+	if err != nil {
+		return nil, fmt.Errorf("cache %s: %w", f.CacheFile, err)
+	}
+	return &cachedConfig{etag: c.ETag, config: cfg}, nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, c *cachedConfig) (*Config, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c != nil && c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && c != nil {
+		return c.config, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxConfigBytes {
+		return nil, fmt.Errorf("configuration is over %d bytes", maxConfigBytes)
+	}
+	cfg, err := Parse(f.App, b)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.saveCache(cache{ETag: resp.Header.Get("ETag"), Config: b}); err != nil {
+		return cfg, fmt.Errorf("saving configuration cache: %w", err)
+	}
+	return cfg, nil
+}
+
+// saveCache replaces the cache file atomically.
+func (f *Fetcher) saveCache(c cache) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.CacheFile), filepath.Base(f.CacheFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.CacheFile)
+}
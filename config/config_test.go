@@ -0,0 +1,233 @@
+package config
+
+import (
+	"context"
+	"go_collector/collector"
+	"go_collector/handle"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
+
+func TestMain(m *testing.M) {
+	// Apply the flag defaults so that the flags validated against have values.
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		err  string
+	}{
+		{name: "empty", body: `{}`},
+		{
+			name: "full",
+			body: `{"collectors": ["meminfo", "cpu", "ethtool"], "modules": {"processes": true, "disk_io": false}, "interval": "2s",
+				"filters": {"collector.netdev.device-exclude": "^(lo|docker[0-9]+)$", "collector.hwmon.chip-include": "coretemp"}}`,
+		},
+		{name: "not json", body: `collectors`, err: "invalid configuration"},
+		{name: "unknown field", body: `{"collector": ["cpu"]}`, err: "unknown field"},
+		{name: "unknown collector", body: `{"collectors": ["cpu", "gpu"]}`, err: `unknown collector "gpu"`},
+		{name: "unknown module", body: `{"modules": {"gpus": true}}`, err: `unknown handle module "gpus"`},
+		{name: "required module disabled", body: `{"modules": {"network": false}}`, err: `handle module "network" is required`},
+		{name: "bad interval", body: `{"interval": "soon"}`, err: "not a positive duration"},
+		{name: "negative interval", body: `{"interval": "-1s"}`, err: "not a positive duration"},
+		{name: "not a filter", body: `{"filters": {"collector.textfile.directory": "/tmp"}}`, err: "not an include or exclude flag"},
+		{name: "unknown filter", body: `{"filters": {"collector.gpu.device-include": "0"}}`, err: "unknown flag"},
+		{name: "list filter", body: `{"filters": {"collector.sysctl.include": "vm.swappiness"}}`, err: "does not take a regular expression"},
+		{name: "bad regexp", body: `{"filters": {"collector.netdev.device-include": "eth[0-"}}`, err: "collector.netdev.device-include"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(kingpin.CommandLine, []byte(tc.body))
+			if tc.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func testApp() *kingpin.Application {
+	app := kingpin.New("test", "")
+	app.Flag("collector.cpu", "").Default("true").Bool()
+	app.Flag("collector.ethtool", "").Default("false").Bool()
+	app.Flag("collector.netdev", "").Default("true").Bool()
+	app.Flag("collector.netdev.device-exclude", "").String()
+	app.Flag("collector.process", "").Default("false").Bool()
+	app.Flag("collector.diskstats", "").Default("true").Bool()
+	app.Flag("handle.processes", "").Default("false").Bool()
+	app.Flag("handle.disk_io", "").Default("true").Bool()
+	app.Flag("handle.rate-interval", "").Default("1s").Duration()
+	return app
+}
+
+func TestApply(t *testing.T) {
+	cfg := &Config{
+		Collectors: []string{"cpu", "ethtool", "netdev"},
+		Modules:    map[string]bool{"processes": true, "disk_io": false},
+		Interval:   "2s",
+		Filters:    map[string]string{"collector.netdev.device-exclude": "^lo$"},
+	}
+	for _, tc := range []struct {
+		name       string
+		args       []string
+		collectors []string
+		values     map[string]string
+	}{
+		{
+			name:       "defaults",
+			collectors: []string{"cpu", "ethtool", "netdev"},
+			values: map[string]string{
+				"collector.ethtool": "true", "handle.processes": "true", "collector.process": "true", "handle.disk_io": "false",
+				"handle.rate-interval": "2s", "collector.netdev.device-exclude": "^lo$",
+			},
+		},
+		{
+			name:       "module collector disabled on the command line",
+			args:       []string{"--no-collector.process"},
+			collectors: []string{"cpu", "ethtool", "netdev"},
+			values:     map[string]string{"handle.processes": "false", "collector.process": "false", "handle.disk_io": "false"},
+		},
+		{
+			name:       "command line",
+			args:       []string{"--no-collector.ethtool", "--handle.rate-interval=5s", "--collector.netdev.device-exclude=^docker"},
+			collectors: []string{"cpu", "netdev"},
+			values: map[string]string{
+				"collector.ethtool": "false", "handle.processes": "true",
+				"handle.rate-interval": "5s", "collector.netdev.device-exclude": "^docker",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app := testApp()
+			if _, err := app.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			collectors, err := cfg.Apply(app, Explicit(app, tc.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(collectors, tc.collectors) {
+				t.Errorf("expected collectors %v, got %v", tc.collectors, collectors)
+			}
+			for name, want := range tc.values {
+				if got := app.GetFlag(name).Model().String(); got != want {
+					t.Errorf("expected --%s=%s, got %s", name, want, got)
+				}
+			}
+		})
+	}
+
+	collectors, err := (&Config{Interval: "2s"}).Apply(testApp(), nil)
+	if err != nil || collectors != nil {
+		t.Errorf("expected the collectors to be left to the caller, got %v, %v", collectors, err)
+	}
+}
+
+func TestApplyNodeCollector(t *testing.T) {
+	// The processes module depends on the process collector, disabled by
+	// default.
+	cfg, err := Parse(kingpin.CommandLine, []byte(`{"collectors": ["meminfo"], "modules": {"processes": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectors, err := cfg.Apply(kingpin.CommandLine, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := collector.NewNodeCollector(log.NewNopLogger(), append(collectors, handle.Collectors()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"meminfo", "process"} {
+		if _, ok := nc.Collectors[name]; !ok {
+			t.Errorf("expected the %s collector to run, got %v", name, nc.Collectors)
+		}
+	}
+}
+
+// configServer serves body with an ETag, answering 304 to a matching
+// If-None-Match, or code when set.
+type configServer struct {
+	body     string
+	etag     string
+	code     int
+	requests []string
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r.Header.Get("If-None-Match"))
+	if s.code != 0 {
+		w.WriteHeader(s.code)
+		return
+	}
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.body))
+}
+
+func TestFetch(t *testing.T) {
+	cs := &configServer{body: `{"collectors": ["cpu"], "interval": "2s"}`, etag: `"v1"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+	f := &Fetcher{URL: srv.URL, CacheFile: filepath.Join(t.TempDir(), "remote_config.json"), App: kingpin.CommandLine}
+	fetch := func(name string, wantCached bool, wantErr bool) *Config {
+		t.Helper()
+		cfg, cached, err := f.Fetch(context.Background())
+		if cached != wantCached || (err != nil) != wantErr {
+			t.Errorf("%s: expected cached %v and error %v, got %v, %v", name, wantCached, wantErr, cached, err)
+		}
+		return cfg
+	}
+
+	if cfg := fetch("first", false, false); cfg == nil || cfg.Interval != "2s" {
+		t.Fatalf("first: unexpected configuration %+v", cfg)
+	}
+	if cfg := fetch("not modified", false, false); cfg == nil || cfg.Interval != "2s" {
+		t.Errorf("not modified: expected the cached configuration, got %+v", cfg)
+	}
+	if cs.requests[1] != `"v1"` {
+		t.Errorf("expected the ETag to be revalidated, got If-None-Match %q", cs.requests[1])
+	}
+
+	cs.body, cs.etag = `{"collectors": ["gpu"]}`, `"v2"`
+	if cfg := fetch("invalid", true, true); cfg == nil || cfg.Interval != "2s" {
+		t.Errorf("invalid: expected the cached configuration, got %+v", cfg)
+	}
+
+	cs.body, cs.etag = `{"interval": "3s"}`, `"v3"`
+	if cfg := fetch("changed", false, false); cfg == nil || cfg.Interval != "3s" {
+		t.Errorf("changed: unexpected configuration %+v", cfg)
+	}
+
+	cs.code = http.StatusBadGateway
+	if cfg := fetch("server error", true, true); cfg == nil || cfg.Interval != "3s" {
+		t.Errorf("server error: expected the cached configuration, got %+v", cfg)
+	}
+
+	srv.Close()
+	if cfg := fetch("unreachable", true, true); cfg == nil || cfg.Interval != "3s" {
+		t.Errorf("unreachable: expected the cached configuration, got %+v", cfg)
+	}
+
+	os.Remove(f.CacheFile)
+	if cfg := fetch("unreachable without cache", false, true); cfg != nil {
+		t.Errorf("unreachable without cache: expected no configuration, got %+v", cfg)
+	}
+}
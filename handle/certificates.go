@@ -0,0 +1,86 @@
+package handle
+
+import (
+	"sort"
+	"strings"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// CertificateStruct is a certificate found in a local file.
+type CertificateStruct struct {
+	File          string   `json:"file"`
+	Serial        string   `json:"serial"`
+	Subject       string   `json:"subject"`
+	Issuer        string   `json:"issuer"`
+	DNSNames      []string `json:"dns_names"`
+	NotAfter      float64  `json:"not_after"`
+	DaysRemaining float64  `json:"days_remaining"`
+}
+
+// CertificatesStruct lists the certificates and the files that could not be
+// read or held no certificate.
+type CertificatesStruct struct {
+	Certificates []CertificateStruct `json:"certificates"`
+	Errors       []string            `json:"errors"`
+}
+
+func init() {
+	registerModule("certificates", defaultDisabled, []string{"certfile"}, false, buildCertificates)
+}
+
+func setCertificates(mfs []*io_prometheus_client.MetricFamily, certificates *CertificatesStruct) {
+	byKey := map[string]*CertificateStruct{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			if mf.GetName() == "node_certfile_file_error" {
+				if m.GetGauge().GetValue() == 1 {
+					certificates.Errors = append(certificates.Errors, labelValue(m, "file"))
+				}
+				continue
+			}
+			key := labelValue(m, "file") + "\x00" + labelValue(m, "serial")
+			cert, ok := byKey[key]
+			if !ok {
+				cert = &CertificateStruct{
+					File:     labelValue(m, "file"),
+					Serial:   labelValue(m, "serial"),
+					Subject:  labelValue(m, "subject"),
+					Issuer:   labelValue(m, "issuer"),
+					DNSNames: []string{},
+				}
+				if names := labelValue(m, "dns_names"); names != "" {
+					cert.DNSNames = strings.Split(names, ",")
+				}
+			}
+			switch mf.GetName() {
+			case "node_certfile_not_after_seconds":
+				cert.NotAfter = m.GetGauge().GetValue()
+			case "node_certfile_days_remaining":
+				cert.DaysRemaining = m.GetGauge().GetValue()
+			default:
+				continue
+			}
+			byKey[key] = cert
+		}
+	}
+
+	for _, cert := range byKey {
+		certificates.Certificates = append(certificates.Certificates, *cert)
+	}
+	// Soonest expiry first.
+	sort.Slice(certificates.Certificates, func(i, j int) bool {
+		a, b := certificates.Certificates[i], certificates.Certificates[j]
+		if a.NotAfter != b.NotAfter {
+			return a.NotAfter < b.NotAfter
+		}
+		return a.File+a.Serial < b.File+b.Serial
+	})
+	sort.Strings(certificates.Errors)
+}
+
+func buildCertificates(in *Input) (interface{}, error) {
+	certificates := CertificatesStruct{Certificates: []CertificateStruct{}, Errors: []string{}}
+	setCertificates(in.Last, &certificates)
+	return certificates, nil
+}
@@ -2,15 +2,11 @@
 package handle
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
@@ -21,21 +17,24 @@ type Core struct {
 
 type CollectCPUInfoStruct map[string][]Core
 
-var PrevCollectCPUInfo *CollectCPUInfoStruct = &CollectCPUInfoStruct{}
-var LastCollectCPUInfo *CollectCPUInfoStruct = &CollectCPUInfoStruct{}
-
 type CPUAttr struct {
 	ID     string `json:"cpu"`
 	Value  string `json:"value"`
 	Sensor string `json:"sensor"`
 }
 
-type CPUInfoStruct struct {
-	Usage       []CPUAttr `json:"usage"`
-	Temperature []CPUAttr `json:"temperature"`
+// CPUUsage is the fraction of the rate interval a CPU was busy, to the
+// hundredth, null when unavailable. Sensor is always empty.
+type CPUUsage struct {
+	ID     string   `json:"cpu"`
+	Value  *float64 `json:"value"`
+	Sensor string   `json:"sensor"`
 }
 
-var CPUInfo CPUInfoStruct
+type CPUInfoStruct struct {
+	Usage       []CPUUsage `json:"usage"`
+	Temperature []CPUAttr  `json:"temperature"`
+}
 
 func setCPUCollect(mfs []*io_prometheus_client.MetricFamily, CollectCPUInfo *CollectCPUInfoStruct) {
 	for _, mf := range mfs {
@@ -65,7 +64,7 @@ func setCPUCollect(mfs []*io_prometheus_client.MetricFamily, CollectCPUInfo *Col
 	}
 }
 
-func setCPUTemperature(mfs []*io_prometheus_client.MetricFamily) {
+func setCPUTemperature(mfs []*io_prometheus_client.MetricFamily, cpuInfo *CPUInfoStruct) {
 	_tempTemperature := []CPUAttr{}
 	for _, mf := range mfs {
 	outloop:
@@ -90,7 +89,7 @@ func setCPUTemperature(mfs []*io_prometheus_client.MetricFamily) {
 						sensor = chip + "_" + *lp.Value
 					}
 				}
-				CPUInfo.Temperature = append(CPUInfo.Temperature, CPUAttr{
+				cpuInfo.Temperature = append(cpuInfo.Temperature, CPUAttr{
 					ID:     chip + "_" + id,
 					Sensor: sensor,
 				})
@@ -114,69 +113,66 @@ func setCPUTemperature(mfs []*io_prometheus_client.MetricFamily) {
 			}
 		}
 	}
-	CPUInfo.Temperature = mergeCPUTemperature(CPUInfo.Temperature, _tempTemperature)
+	cpuInfo.Temperature = mergeCPUTemperature(cpuInfo.Temperature, _tempTemperature)
 }
 
-func HandleCPU(r *prometheus.Registry) {
-	wg := sync.WaitGroup{}
-	wg.Add(2)
-	go func() {
-		if prevCollect, err := r.Gather(); err == nil {
-			setCPUCollect(prevCollect, PrevCollectCPUInfo)
-		}
-		wg.Done()
-	}()
-	go func() {
-		time.Sleep(time.Second * 1)
-		if lastCollect, err := r.Gather(); err == nil {
-			setCPUCollect(lastCollect, LastCollectCPUInfo)
-			//采集最新数据时一并处理温度数据
-			setCPUTemperature(lastCollect)
-		}
-		wg.Done()
-	}()
-	wg.Wait()
-
-	for CoreID, CoreInfo := range *LastCollectCPUInfo {
-		prevCoreInfo := (*PrevCollectCPUInfo)[CoreID]
-		var totalSecond float64 = 0
-		var idleSecond float64 = 0
-		var prevTotalSecond float64 = 0
-		var prevIdleSecond float64 = 0
-		for _, core := range CoreInfo {
-			if core.Mode == "idle" {
-				idleSecond = core.Value
-			}
-			totalSecond += core.Value
-		}
-		for _, core := range prevCoreInfo {
-			if core.Mode == "idle" {
-				prevIdleSecond = core.Value
-			}
-			prevTotalSecond += core.Value
-		}
-		CPUInfo.Usage = append(CPUInfo.Usage, CPUAttr{
+func init() {
+	registerModule("cpus", defaultEnabled, []string{"cpu", "hwmon"}, true, buildCPU)
+}
+
+func buildCPU(in *Input) (interface{}, error) {
+	prevCollectCPUInfo := CollectCPUInfoStruct{}
+	lastCollectCPUInfo := CollectCPUInfoStruct{}
+	cpuInfo := CPUInfoStruct{Usage: []CPUUsage{}, Temperature: []CPUAttr{}}
+	setCPUCollect(in.Prev, &prevCollectCPUInfo)
+	setCPUCollect(in.Last, &lastCollectCPUInfo)
+	//采集最新数据时一并处理温度数据
+	setCPUTemperature(in.Last, &cpuInfo)
+
+	for CoreID, CoreInfo := range lastCollectCPUInfo {
+		prevCoreInfo, hasPrev := prevCollectCPUInfo[CoreID]
+		idleSecond, totalSecond := cpuIdleAndTotal(CoreInfo)
+		prevIdleSecond, prevTotalSecond := cpuIdleAndTotal(prevCoreInfo)
+		// The usage of a CPU brought online within the interval, whose
+		// counters were reset or did not move is unavailable.
+		idle, idleOK := counterDelta(prevIdleSecond, idleSecond, hasPrev)
+		total, totalOK := counterDelta(prevTotalSecond, totalSecond, hasPrev)
+		idleRatio, ok := ratio(idle, total)
+		cpuInfo.Usage = append(cpuInfo.Usage, CPUUsage{
 			ID:    CoreID,
-			Value: strconv.FormatFloat(1-(idleSecond-prevIdleSecond)/(totalSecond-prevTotalSecond), 'f', 2, 64),
+			Value: available(math.Round((1-idleRatio)*100)/100, idleOK && totalOK && ok),
 		})
 	}
+	sort.Slice(cpuInfo.Usage, func(i, j int) bool { return cpuIDLess(cpuInfo.Usage[i].ID, cpuInfo.Usage[j].ID) })
 
-	file, err := os.OpenFile("cpu_info.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		os.Exit(1)
-	}
-	defer file.Close()
-
-	// 将数据写入 JSON 文件
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(CPUInfo); err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		os.Exit(1)
+	return cpuInfo, nil
+}
+
+// cpuIdleAndTotal returns the idle seconds of a CPU and the seconds spent in
+// all modes.
+func cpuIdleAndTotal(cores []Core) (idle, total float64) {
+	for _, core := range cores {
+		if core.Mode == "idle" {
+			idle = core.Value
+		}
+		total += core.Value
 	}
+	return idle, total
+}
 
-	fmt.Println("Memory metrics have been written to cpu_info.json")
+// sortCPUAttrs orders attributes by ID.
+func sortCPUAttrs(attrs []CPUAttr) {
+	sort.Slice(attrs, func(i, j int) bool { return cpuIDLess(attrs[i].ID, attrs[j].ID) })
+}
+
+// cpuIDLess compares CPU IDs, numeric ones numerically.
+func cpuIDLess(x, y string) bool {
+	a, errA := strconv.Atoi(x)
+	b, errB := strconv.Atoi(y)
+	if errA == nil && errB == nil {
+		return a < b
+	}
+	return x < y
 }
 
 func mergeCPUTemperature(label []CPUAttr, temperature []CPUAttr) []CPUAttr {
@@ -206,6 +202,7 @@ func mergeCPUTemperature(label []CPUAttr, temperature []CPUAttr) []CPUAttr {
 	for _, v := range mergedMap {
 		result = append(result, v)
 	}
+	sortCPUAttrs(result)
 
 	return result
 }
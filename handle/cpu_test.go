@@ -0,0 +1,256 @@
+package handle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func coreLabel(chip, sensor, label string) sample {
+	return sample{labels: map[string]string{"chip": chip, "sensor": sensor, "label": label}, value: 1}
+}
+
+func coreTemp(chip, sensor string, value float64) sample {
+	return sample{labels: map[string]string{"chip": chip, "sensor": sensor}, value: value}
+}
+
+func TestSetCPUCollect(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mfs  []*io_prometheus_client.MetricFamily
+		want CollectCPUInfoStruct
+	}{
+		{
+			name: "modes per cpu",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_cpu_seconds_total", append(cpuSeconds("0", 100, 50), cpuSeconds("1", 200, 25)...)...),
+			},
+			want: CollectCPUInfoStruct{
+				"0": {{Mode: "idle", Value: 100}, {Mode: "user", Value: 50}},
+				"1": {{Mode: "idle", Value: 200}, {Mode: "user", Value: 25}},
+			},
+		},
+		{
+			name: "other families ignored",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_cpu_guest_seconds_total", cpuSeconds("0", 1, 1)...),
+				counter("node_cpu_seconds_total", cpuSeconds("0", 100, 50)...),
+			},
+			want: CollectCPUInfoStruct{
+				"0": {{Mode: "idle", Value: 100}, {Mode: "user", Value: 50}},
+			},
+		},
+		{
+			// Counters are kept as read; resets are for the rate to handle.
+			name: "counter reset",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_cpu_seconds_total", cpuSeconds("0", 0, 0)...),
+			},
+			want: CollectCPUInfoStruct{
+				"0": {{Mode: "idle", Value: 0}, {Mode: "user", Value: 0}},
+			},
+		},
+		{
+			name: "no cpu metrics",
+			mfs:  []*io_prometheus_client.MetricFamily{gauge("node_memory_MemFree_bytes", sample{value: 1})},
+			want: CollectCPUInfoStruct{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CollectCPUInfoStruct{}
+			setCPUCollect(tc.mfs, &got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSetCPUTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mfs  []*io_prometheus_client.MetricFamily
+		want []CPUAttr
+	}{
+		{
+			name: "cores",
+			mfs: []*io_prometheus_client.MetricFamily{
+				gauge("node_hwmon_sensor_label",
+					coreLabel("platform_coretemp_0", "temp2", "Core 0"),
+					coreLabel("platform_coretemp_0", "temp3", "Core 1"),
+				),
+				gauge("node_hwmon_temp_celsius",
+					coreTemp("platform_coretemp_0", "temp2", 41),
+					coreTemp("platform_coretemp_0", "temp3", 43.456),
+				),
+			},
+			want: []CPUAttr{
+				{ID: "0_0", Value: "41.00", Sensor: "0_temp2"},
+				{ID: "0_1", Value: "43.46", Sensor: "0_temp3"},
+			},
+		},
+		{
+			name: "package and other chips ignored",
+			mfs: []*io_prometheus_client.MetricFamily{
+				gauge("node_hwmon_sensor_label",
+					coreLabel("platform_coretemp_0", "temp1", "Package id 0"),
+					coreLabel("platform_coretemp_0", "temp2", "Core 0"),
+					coreLabel("platform_nct6775_656", "temp1", "SYSTIN"),
+				),
+				gauge("node_hwmon_temp_celsius",
+					coreTemp("platform_coretemp_0", "temp1", 50),
+					coreTemp("platform_coretemp_0", "temp2", 41),
+					coreTemp("platform_nct6775_656", "temp1", 30),
+				),
+			},
+			want: []CPUAttr{{ID: "0_0", Value: "41.00", Sensor: "0_temp2"}},
+		},
+		{
+			name: "two sockets",
+			mfs: []*io_prometheus_client.MetricFamily{
+				gauge("node_hwmon_sensor_label",
+					coreLabel("platform_coretemp_1", "temp2", "Core 0"),
+					coreLabel("platform_coretemp_0", "temp2", "Core 0"),
+				),
+				gauge("node_hwmon_temp_celsius",
+					coreTemp("platform_coretemp_0", "temp2", 41),
+					coreTemp("platform_coretemp_1", "temp2", 45),
+				),
+			},
+			want: []CPUAttr{
+				{ID: "0_0", Value: "41.00", Sensor: "0_temp2"},
+				{ID: "1_0", Value: "45.00", Sensor: "1_temp2"},
+			},
+		},
+		{
+			name: "missing sensor reading",
+			mfs: []*io_prometheus_client.MetricFamily{
+				gauge("node_hwmon_sensor_label",
+					coreLabel("platform_coretemp_0", "temp2", "Core 0"),
+					coreLabel("platform_coretemp_0", "temp3", "Core 1"),
+				),
+				gauge("node_hwmon_temp_celsius", coreTemp("platform_coretemp_0", "temp2", 41)),
+			},
+			want: []CPUAttr{
+				{ID: "0_0", Value: "41.00", Sensor: "0_temp2"},
+				{ID: "0_1", Value: "", Sensor: "0_temp3"},
+			},
+		},
+		{
+			name: "no hwmon",
+			mfs:  []*io_prometheus_client.MetricFamily{counter("node_cpu_seconds_total", cpuSeconds("0", 1, 1)...)},
+			want: []CPUAttr{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got CPUInfoStruct
+			setCPUTemperature(tc.mfs, &got)
+			if !reflect.DeepEqual(got.Temperature, tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got.Temperature)
+			}
+		})
+	}
+}
+
+func TestMergeCPUTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		labels      []CPUAttr
+		temperature []CPUAttr
+		want        []CPUAttr
+	}{
+		{
+			name:        "matched by sensor",
+			labels:      []CPUAttr{{ID: "0_1", Sensor: "0_temp3"}, {ID: "0_0", Sensor: "0_temp2"}},
+			temperature: []CPUAttr{{Sensor: "0_temp2", Value: "41.00"}, {Sensor: "0_temp3", Value: "43.00"}},
+			want:        []CPUAttr{{ID: "0_0", Sensor: "0_temp2", Value: "41.00"}, {ID: "0_1", Sensor: "0_temp3", Value: "43.00"}},
+		},
+		{
+			name:        "unlabelled temperatures dropped",
+			labels:      []CPUAttr{{ID: "0_0", Sensor: "0_temp2"}},
+			temperature: []CPUAttr{{Sensor: "0_temp1", Value: "50.00"}, {Sensor: "0_temp2", Value: "41.00"}},
+			want:        []CPUAttr{{ID: "0_0", Sensor: "0_temp2", Value: "41.00"}},
+		},
+		{
+			name:   "missing temperatures",
+			labels: []CPUAttr{{ID: "0_0", Sensor: "0_temp2"}},
+			want:   []CPUAttr{{ID: "0_0", Sensor: "0_temp2"}},
+		},
+		{
+			name:        "nothing labelled",
+			temperature: []CPUAttr{{Sensor: "0_temp2", Value: "41.00"}},
+			want:        []CPUAttr{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeCPUTemperature(tc.labels, tc.temperature); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func usage(v float64) *float64 { return &v }
+
+func TestBuildCPU(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		prev, last []sample
+		want       []CPUUsage
+	}{
+		{
+			name: "usage from deltas",
+			prev: append(cpuSeconds("0", 100, 100), cpuSeconds("1", 100, 100)...),
+			last: append(cpuSeconds("0", 110, 110), cpuSeconds("1", 120, 100)...),
+			want: []CPUUsage{{ID: "0", Value: usage(0.5)}, {ID: "1", Value: usage(0)}},
+		},
+		{
+			name: "numeric order",
+			prev: append(cpuSeconds("10", 0, 0), cpuSeconds("2", 0, 0)...),
+			last: append(cpuSeconds("10", 1, 3), cpuSeconds("2", 3, 1)...),
+			want: []CPUUsage{{ID: "2", Value: usage(0.25)}, {ID: "10", Value: usage(0.75)}},
+		},
+		{
+			name: "counter reset",
+			prev: cpuSeconds("0", 1000, 1000),
+			last: cpuSeconds("0", 5, 5),
+			want: []CPUUsage{{ID: "0"}},
+		},
+		{
+			name: "cpu brought online",
+			prev: cpuSeconds("0", 100, 100),
+			last: append(cpuSeconds("0", 110, 110), cpuSeconds("1", 1, 1)...),
+			want: []CPUUsage{{ID: "0", Value: usage(0.5)}, {ID: "1"}},
+		},
+		{
+			name: "no time elapsed",
+			prev: cpuSeconds("0", 100, 100),
+			last: cpuSeconds("0", 100, 100),
+			want: []CPUUsage{{ID: "0"}},
+		},
+		{
+			// user went backwards on its own; the totals still moved forward.
+			name: "mode counter jitter",
+			prev: cpuSeconds("0", 100, 100),
+			last: cpuSeconds("0", 120, 99.99),
+			want: []CPUUsage{{ID: "0", Value: usage(0)}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := buildCPU(&Input{
+				Prev: []*io_prometheus_client.MetricFamily{counter("node_cpu_seconds_total", tc.prev...)},
+				Last: []*io_prometheus_client.MetricFamily{counter("node_cpu_seconds_total", tc.last...)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usage := got.(CPUInfoStruct).Usage; !reflect.DeepEqual(usage, tc.want) {
+				want, _ := json.Marshal(tc.want)
+				got, _ := json.Marshal(usage)
+				t.Errorf("want %s, got %s", want, got)
+			}
+		})
+	}
+}
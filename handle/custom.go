@@ -0,0 +1,120 @@
+package handle
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// CustomMetric is one sample printed by a script.
+type CustomMetric struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+	// Value is null when the script printed NaN or an infinity, which JSON
+	// cannot encode.
+	Value *float64 `json:"value"`
+	// Count is only set for summaries and histograms, whose Value is the sum.
+	Count uint64 `json:"count,omitempty"`
+}
+
+// CustomScript is the result of one script run by the script collector.
+type CustomScript struct {
+	Success  bool           `json:"success"`
+	Duration float64        `json:"duration_seconds"`
+	Metrics  []CustomMetric `json:"metrics"`
+}
+
+// scriptLabel is the label the script collector adds, and
+// exportedScriptLabel the script label a script printed itself.
+const (
+	scriptLabel         = "script"
+	exportedScriptLabel = "exported_script"
+)
+
+func init() {
+	registerModule("custom", defaultDisabled, []string{"script"}, false, buildCustom)
+}
+
+func buildCustom(in *Input) (interface{}, error) {
+	custom := map[string]*CustomScript{}
+	script := func(name string) *CustomScript {
+		if _, ok := custom[name]; !ok {
+			custom[name] = &CustomScript{Metrics: []CustomMetric{}}
+		}
+		return custom[name]
+	}
+
+	// Only the scripts the collector ran, which it reports the success of,
+	// have entries: other collectors may use a script label too.
+	for _, mf := range in.Last {
+		if mf.GetName() != "node_script_success" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == scriptLabel {
+					script(lp.GetValue()).Success = m.GetGauge().GetValue() == 1
+				}
+			}
+		}
+	}
+
+	for _, mf := range in.Last {
+		if mf.GetName() == "node_script_success" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			labels := map[string]string{}
+			var name string
+			for _, lp := range m.Label {
+				switch lp.GetName() {
+				case scriptLabel:
+					name = lp.GetValue()
+				case exportedScriptLabel:
+					labels[scriptLabel] = lp.GetValue()
+				default:
+					labels[lp.GetName()] = lp.GetValue()
+				}
+			}
+			if _, ok := custom[name]; !ok {
+				continue
+			}
+
+			switch mf.GetName() {
+			case "node_script_duration_seconds":
+				script(name).Duration = m.GetGauge().GetValue()
+				continue
+			}
+			metric := CustomMetric{
+				Name:   mf.GetName(),
+				Type:   strings.ToLower(mf.GetType().String()),
+				Labels: labels,
+			}
+			var value float64
+			switch mf.GetType() {
+			case io_prometheus_client.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case io_prometheus_client.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case io_prometheus_client.MetricType_SUMMARY:
+				value = m.GetSummary().GetSampleSum()
+				metric.Count = m.GetSummary().GetSampleCount()
+			case io_prometheus_client.MetricType_HISTOGRAM:
+				value = m.GetHistogram().GetSampleSum()
+				metric.Count = m.GetHistogram().GetSampleCount()
+			default:
+				value = m.GetUntyped().GetValue()
+			}
+			metric.Value = available(value, !math.IsNaN(value) && !math.IsInf(value, 0))
+			script(name).Metrics = append(script(name).Metrics, metric)
+		}
+	}
+
+	for _, s := range custom {
+		sort.SliceStable(s.Metrics, func(i, j int) bool { return s.Metrics[i].Name < s.Metrics[j].Name })
+	}
+	return custom, nil
+}
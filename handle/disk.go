@@ -0,0 +1,13 @@
+package handle
+
+import (
+	diskHandle "go_collector/handle/disk"
+)
+
+func init() {
+	registerModule("disks", defaultEnabled, nil, false, buildDisks)
+}
+
+func buildDisks(in *Input) (interface{}, error) {
+	return diskHandle.GetInfo(in.Report)
+}
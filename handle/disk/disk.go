@@ -1,5 +1,11 @@
 package handle
 
+import (
+	"go_collector/bin"
+	"go_collector/handle/status"
+	"strings"
+)
+
 type Smartctl struct {
 	Devices []Device `json:"devices"`
 }
@@ -18,7 +24,7 @@ type DiskInfo struct {
 	Temperature  Temperature  `json:"temperature"`
 	PowerOnTime  PowerOnTime  `json:"power_on_time"`
 	SerialNumber string       `json:"serial_number"`
-	RotationRate interface{}  `json:"rotation_rate,omitempty"`
+	RotationRate *int64       `json:"rotation_rate,omitempty"`
 	Device       Device       `json:"device"`
 	SetaVersion  SetaVersion  `json:"seta_version"`
 	ScsiVendor   string       `json:"scsi_vendor"`
@@ -46,3 +52,25 @@ type Temperature struct {
 type PowerOnTime struct {
 	Hours int64 `json:"hours"`
 }
+
+func init() {
+	// --json needs smartctl 7.0.
+	bin.RegisterTool(bin.Tool{
+		Name:           "smartctl",
+		Files:          []string{smartctlPath},
+		VersionArgs:    []string{"--version"},
+		VersionPattern: `smartctl (\d+(?:\.\d+)*)`,
+		MinVersion:     "7.0",
+	})
+}
+
+// runSmartctl runs smartctl and records the run in report.
+func runSmartctl(report *status.Report, args ...string) ([]byte, error) {
+	var output []byte
+	err := report.Time(status.KindCommand, "smartctl "+strings.Join(args, " "), func() error {
+		var err error
+		output, err = bin.RunTool("smartctl", args...)
+		return err
+	})
+	return output, err
+}
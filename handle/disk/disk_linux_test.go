@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+package handle
+
+import (
+	"go_collector/bin"
+	"go_collector/handle/status"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// smartctl outputs recorded from hosts with a SATA SSD, an LSI MegaRAID
+	// controller with a disk behind it and an NVMe drive.
+	bin.Replay("testdata")
+	os.Exit(m.Run())
+}
+
+func TestGetDiskInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path string
+		args []string
+		want DiskInfo
+	}{
+		{
+			name: "sata ssd",
+			path: "/dev/sda [SAT]",
+			args: []string{"--json=c", "-a", "/dev/sda [SAT]", "-d", "sat"},
+			want: DiskInfo{
+				ModelName:    "Samsung SSD 860 QVO 1TB",
+				SerialNumber: "S4CZNG0M159928Y",
+				ModelType:    "SATA ssd",
+				SmartStatus:  SmartStatus{Passed: true},
+				Temperature:  Temperature{Current: 17},
+				PowerOnTime:  PowerOnTime{Hours: 23860},
+			},
+		},
+		{
+			name: "hdd behind megaraid",
+			path: "/dev/bus/0 [megaraid_disk_00] [SAT]",
+			args: []string{"--json=c", "-a", "/dev/bus/0 [megaraid_disk_00] [SAT]", "-d", "sat+megaraid,0"},
+			want: DiskInfo{
+				ModelName:    "ST4000NM0035-1V4107",
+				SerialNumber: "ZC1A2B3C",
+				ModelType:    "ATA hdd",
+				SmartStatus:  SmartStatus{Passed: true},
+				Temperature:  Temperature{Current: 34},
+				PowerOnTime:  PowerOnTime{Hours: 41210},
+			},
+		},
+		{
+			// smartctl exits non-zero when the drive is failing; its output
+			// is still used.
+			name: "failing nvme",
+			path: "/dev/nvme0",
+			args: []string{"--json=c", "-a", "/dev/nvme0", "-d", "nvme"},
+			want: DiskInfo{
+				ModelName:    "INTEL SSDPE2KX010T8",
+				SerialNumber: "PHLJ912345671P0FGN",
+				ModelType:    "NVMe ssd",
+				Temperature:  Temperature{Current: 48},
+				PowerOnTime:  PowerOnTime{Hours: 30112},
+			},
+		},
+		{
+			name: "lsi virtual drive",
+			path: "/dev/sdb",
+			args: []string{"--json=c", "-a", "/dev/sdb"},
+			want: DiskInfo{},
+		},
+		{
+			name: "no output",
+			path: "/dev/sdz",
+			args: []string{"--json=c", "-a", "/dev/sdz"},
+			want: DiskInfo{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := getDiskInfo(status.NewReport(), tc.path, tc.args...)
+			if got.ModelName != tc.want.ModelName || got.SerialNumber != tc.want.SerialNumber ||
+				got.ModelType != tc.want.ModelType || got.SmartStatus != tc.want.SmartStatus ||
+				got.Temperature != tc.want.Temperature || got.PowerOnTime != tc.want.PowerOnTime {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	report := status.NewReport()
+	disks, err := GetInfo(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The LSI virtual drive is left out.
+	want := []string{"/dev/bus/0", "/dev/nvme0", "/dev/sda"}
+	if len(disks) != len(want) {
+		t.Fatalf("want disks %v, got %+v", want, disks)
+	}
+	for i, d := range disks {
+		if d.Device.Name != want[i] {
+			t.Errorf("disk %d: want %s, got %s", i, want[i], d.Device.Name)
+		}
+	}
+
+	failed := 0
+	for _, step := range report.Steps() {
+		if step.Kind == status.KindCommand && step.Error != "" {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("expected the failing nvme run to be reported, got %d failed commands", failed)
+	}
+}
@@ -6,35 +6,42 @@ package handle
 import (
 	"encoding/json"
 	"fmt"
-	"go_collector/bin"
+	"go_collector/handle/status"
 	"go_collector/utils"
+	"sort"
 	"strings"
 	"sync"
+
+	"github.com/go-kit/log/level"
 )
 
-func GetInfo() []DiskInfo {
+// smartctlPath is the bundled smartctl relative to a tool directory.
+const smartctlPath = "smartctl\\smartctl.exe"
+
+// GetInfo scans for disks with smartctl and returns the SMART information of
+// each one. Command runs are recorded in report.
+func GetInfo(report *status.Report) ([]DiskInfo, error) {
 	args := []string{"--json=c", "--scan"}
-	output, err := bin.RunCommand("smartctl\\smartctl.exe", args...)
+	output, err := runSmartctl(report, args...)
 	if err != nil {
-		utils.Log().Error("Error:%+v", err.Error())
-		return nil
-		// panic(err)
+		level.Error(utils.Logger()).Log("msg", "Couldn't scan for disks", "err", err)
+		return nil, err
 	}
 
 	var s Smartctl
 	if err := json.Unmarshal([]byte(output), &s); err != nil {
-		utils.Log().Error("Error:%+v", err.Error())
-		return nil
-		// panic(err)
+		level.Error(utils.Logger()).Log("msg", "Couldn't parse the smartctl scan", "err", err)
+		return nil, fmt.Errorf("failed to parse smartctl scan: %w", err)
 	}
 
 	disks := []DiskInfo{}
+	var disksMtx sync.Mutex
 	var wg sync.WaitGroup
 	wg.Add(5)
 	var jobs = make(chan *Device, len(s.Devices))
 
-	for _, device := range s.Devices {
-		jobs <- &device
+	for i := range s.Devices {
+		jobs <- &s.Devices[i]
 	}
 
 	for i := 0; i < 5; i++ {
@@ -42,7 +49,6 @@ func GetInfo() []DiskInfo {
 			for {
 				d, ok := <-jobs
 				if !ok {
-					fmt.Println("goroutine done")
 					wg.Done()
 					return
 				}
@@ -52,45 +58,43 @@ func GetInfo() []DiskInfo {
 					append_args := []string{"-d", d.Type}
 					args = append(args, append_args...)
 				}
-				diskInfo := getDiskInfo(d.InfoName, args...)
+				diskInfo := getDiskInfo(report, d.InfoName, args...)
 				if diskInfo.ModelName == "" {
-					return
+					continue
 				}
-				fmt.Println("InfoName:", d.InfoName)
-				fmt.Println("ModelName:", diskInfo.ModelName)
-				fmt.Println("SerialNumber:", diskInfo.SerialNumber)
-				fmt.Println("ModelType:", diskInfo.ModelType)
-				fmt.Println("SmartStatus:", diskInfo.SmartStatus.Passed)
-				fmt.Println("UserCapacity:", diskInfo.UserCapacity.Bytes)
-				fmt.Println("Temperature:", diskInfo.Temperature.Current)
-				fmt.Println("PowerOnTime:", diskInfo.PowerOnTime.Hours)
-				println("=============")
+				level.Debug(utils.Logger()).Log("msg", "Found disk", "device", d.InfoName,
+					"model", diskInfo.ModelName, "serial", diskInfo.SerialNumber, "type", diskInfo.ModelType,
+					"smart_passed", diskInfo.SmartStatus.Passed, "capacity_bytes", diskInfo.UserCapacity.Bytes,
+					"temperature", diskInfo.Temperature.Current, "power_on_hours", diskInfo.PowerOnTime.Hours)
+				disksMtx.Lock()
 				disks = append(disks, diskInfo)
+				disksMtx.Unlock()
 			}
 		}()
 	}
 
 	close(jobs)
 	wg.Wait()
-	return disks
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Device.Name < disks[j].Device.Name })
+	return disks, nil
 }
 
-func getDiskInfo(path string, args ...string) DiskInfo {
-	output, err := bin.RunCommand("smartctl\\smartctl.exe", args...)
+func getDiskInfo(report *status.Report, path string, args ...string) DiskInfo {
+	output, err := runSmartctl(report, args...)
 	if err != nil {
-		fmt.Println("err:", err.Error())
+		level.Warn(utils.Logger()).Log("msg", "smartctl failed", "device", path, "err", err)
 	}
 
 	var s Smartctl
 	if err := json.Unmarshal([]byte(output), &s); err != nil {
-		utils.Log().Error("Error:%+v", err.Error())
+		level.Error(utils.Logger()).Log("msg", "Couldn't parse smartctl output", "device", path, "err", err)
 		return DiskInfo{}
 		// panic(err)
 	}
 
 	var diskInfo DiskInfo
 	if err := json.Unmarshal([]byte(output), &diskInfo); err != nil {
-		fmt.Println("Failed to unmarshal JSON:", err)
+		level.Error(utils.Logger()).Log("msg", "Couldn't parse smartctl output", "device", path, "err", err)
 		return diskInfo
 	}
 
@@ -110,14 +114,10 @@ func getDiskInfo(path string, args ...string) DiskInfo {
 			}
 		}
 	}
-	fmt.Println("RotationRate:", diskInfo.RotationRate)
 
-	if diskInfo.RotationRate != nil {
-		if diskInfo.RotationRate == 0 {
-			modelType = "ssd"
-		} else {
-			modelType = "hdd"
-		}
+	// Solid state drives report a rotation rate of 0, or none at all.
+	if diskInfo.RotationRate != nil && *diskInfo.RotationRate != 0 {
+		modelType = "hdd"
 	} else {
 		modelType = "ssd"
 	}
@@ -0,0 +1,53 @@
+package handle
+
+// DiskIOStruct is the I/O of a block device over the rate interval. Rates
+// are null when unavailable.
+type DiskIOStruct struct {
+	ReadBytes  *float64 `json:"read_bytes_per_second"`
+	WriteBytes *float64 `json:"write_bytes_per_second"`
+	Reads      *float64 `json:"reads_per_second"`
+	Writes     *float64 `json:"writes_per_second"`
+	// Utilization is the fraction of the interval the device was busy.
+	Utilization *float64 `json:"utilization"`
+}
+
+func init() {
+	registerModule("disk_io", defaultEnabled, []string{"diskstats"}, true, buildDiskIO)
+}
+
+// counterRates returns the rate of each sample of the counter called name
+// keyed by its device label.
+func counterRates(in *Input, name string) map[string]*float64 {
+	prev := counterValues(in.Prev, name, "device")
+	rates := map[string]*float64{}
+	interval := in.interval()
+	for device, value := range counterValues(in.Last, name, "device") {
+		before, ok := prev[device]
+		rates[device] = available(counterRate(before, value, ok, interval))
+	}
+	return rates
+}
+
+func buildDiskIO(in *Input) (interface{}, error) {
+	readBytes := counterRates(in, "node_disk_read_bytes_total")
+	writeBytes := counterRates(in, "node_disk_written_bytes_total")
+	reads := counterRates(in, "node_disk_reads_completed_total")
+	writes := counterRates(in, "node_disk_writes_completed_total")
+	busy := counterRates(in, "node_disk_io_time_seconds_total")
+
+	disks := make(map[string]*DiskIOStruct, len(busy))
+	for device, b := range busy {
+		d := &DiskIOStruct{
+			ReadBytes:  readBytes[device],
+			WriteBytes: writeBytes[device],
+			Reads:      reads[device],
+			Writes:     writes[device],
+		}
+		if b != nil {
+			// Busy seconds per second.
+			d.Utilization = available(ratio(*b, 1))
+		}
+		disks[device] = d
+	}
+	return disks, nil
+}
@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestBuildDiskIO(t *testing.T) {
+	disk := func(device string, value float64) sample {
+		return sample{labels: map[string]string{"device": device}, value: value}
+	}
+	// The gathers were half a second apart, whatever the rate interval.
+	start := time.Unix(1700000000, 0)
+	in := &Input{
+		PrevTime: start,
+		LastTime: start.Add(500 * time.Millisecond),
+		Prev: []*io_prometheus_client.MetricFamily{
+			counter("node_disk_read_bytes_total", disk("sda", 4096), disk("sdb", 8192)),
+			counter("node_disk_written_bytes_total", disk("sda", 0), disk("sdb", 8192)),
+			counter("node_disk_reads_completed_total", disk("sda", 1), disk("sdb", 2)),
+			counter("node_disk_writes_completed_total", disk("sda", 0), disk("sdb", 2)),
+			counter("node_disk_io_time_seconds_total", disk("sda", 10), disk("sdb", 20)),
+		},
+		Last: []*io_prometheus_client.MetricFamily{
+			counter("node_disk_read_bytes_total", disk("sda", 12288), disk("sdb", 0), disk("sdc", 0)),
+			counter("node_disk_written_bytes_total", disk("sda", 4096), disk("sdb", 8192), disk("sdc", 0)),
+			counter("node_disk_reads_completed_total", disk("sda", 3), disk("sdb", 0), disk("sdc", 0)),
+			counter("node_disk_writes_completed_total", disk("sda", 1), disk("sdb", 2), disk("sdc", 0)),
+			counter("node_disk_io_time_seconds_total", disk("sda", 10.25), disk("sdb", 21.5), disk("sdc", 0)),
+		},
+	}
+
+	got, err := buildDiskIO(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sdb reads were reset and its busy time outgrew the interval; sdc was
+	// attached within the interval.
+	want := `{"sda":{"read_bytes_per_second":16384,"write_bytes_per_second":8192,"reads_per_second":4,"writes_per_second":2,"utilization":0.5},` +
+		`"sdb":{"read_bytes_per_second":null,"write_bytes_per_second":0,"reads_per_second":null,"writes_per_second":0,"utilization":1},` +
+		`"sdc":{"read_bytes_per_second":null,"write_bytes_per_second":null,"reads_per_second":null,"writes_per_second":null,"utilization":null}}`
+	if string(b) != want {
+		t.Errorf("unexpected disk_io section:\n%s\nwant:\n%s", b, want)
+	}
+}
@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"sort"
+	"strconv"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// KernelMessageStruct is a recent critical kernel message.
+type KernelMessageStruct struct {
+	Time     float64 `json:"time"`
+	Priority int     `json:"priority"`
+	Category string  `json:"category"`
+	Message  string  `json:"message"`
+}
+
+// KernelStruct is what the kmsg collector found in the kernel log.
+type KernelStruct struct {
+	Counts map[string]float64    `json:"counts"`
+	Recent []KernelMessageStruct `json:"recent"`
+}
+
+func init() {
+	registerModule("kernel", defaultDisabled, []string{"kmsg"}, false, buildKernel)
+}
+
+func setKernel(mfs []*io_prometheus_client.MetricFamily, kernel *KernelStruct) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch mf.GetName() {
+			case "node_kmsg_messages_total":
+				kernel.Counts[labelValue(m, "category")] = m.GetCounter().GetValue()
+			case "node_kmsg_recent_message_info":
+				priority, _ := strconv.Atoi(labelValue(m, "priority"))
+				kernel.Recent = append(kernel.Recent, KernelMessageStruct{
+					Time:     m.GetGauge().GetValue(),
+					Priority: priority,
+					Category: labelValue(m, "category"),
+					Message:  labelValue(m, "message"),
+				})
+			}
+		}
+	}
+	sort.SliceStable(kernel.Recent, func(i, j int) bool { return kernel.Recent[i].Time < kernel.Recent[j].Time })
+}
+
+func buildKernel(in *Input) (interface{}, error) {
+	kernel := KernelStruct{Counts: map[string]float64{}, Recent: []KernelMessageStruct{}}
+	setKernel(in.Last, &kernel)
+	return kernel, nil
+}
@@ -0,0 +1,70 @@
+package handle
+
+import (
+	"sort"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// LogSampleStruct is a recent line matching a pattern.
+type LogSampleStruct struct {
+	Time float64 `json:"time"`
+	Line string  `json:"line"`
+}
+
+type LogPatternStruct struct {
+	Matches float64           `json:"matches"`
+	Samples []LogSampleStruct `json:"samples"`
+}
+
+// LogFileStruct is what the logwatch collector found in one file.
+type LogFileStruct struct {
+	Readable bool                         `json:"readable"`
+	Patterns map[string]*LogPatternStruct `json:"patterns"`
+}
+
+func init() {
+	registerModule("logs", defaultDisabled, []string{"logwatch"}, false, buildLogs)
+}
+
+func setLogs(mfs []*io_prometheus_client.MetricFamily, logs map[string]*LogFileStruct) {
+	file := func(name string) *LogFileStruct {
+		if _, ok := logs[name]; !ok {
+			logs[name] = &LogFileStruct{Patterns: map[string]*LogPatternStruct{}}
+		}
+		return logs[name]
+	}
+	pattern := func(f *LogFileStruct, name string) *LogPatternStruct {
+		if _, ok := f.Patterns[name]; !ok {
+			f.Patterns[name] = &LogPatternStruct{Samples: []LogSampleStruct{}}
+		}
+		return f.Patterns[name]
+	}
+
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch mf.GetName() {
+			case "node_logwatch_file_readable":
+				file(labelValue(m, "file")).Readable = m.GetGauge().GetValue() == 1
+			case "node_logwatch_matches_total":
+				f := file(labelValue(m, "file"))
+				pattern(f, labelValue(m, "pattern")).Matches = m.GetCounter().GetValue()
+			case "node_logwatch_sample_info":
+				p := pattern(file(labelValue(m, "file")), labelValue(m, "pattern"))
+				p.Samples = append(p.Samples, LogSampleStruct{Time: m.GetGauge().GetValue(), Line: labelValue(m, "line")})
+			}
+		}
+	}
+
+	for _, f := range logs {
+		for _, p := range f.Patterns {
+			sort.SliceStable(p.Samples, func(i, j int) bool { return p.Samples[i].Time < p.Samples[j].Time })
+		}
+	}
+}
+
+func buildLogs(in *Input) (interface{}, error) {
+	logs := map[string]*LogFileStruct{}
+	setLogs(in.Last, logs)
+	return logs, nil
+}
@@ -1,7 +1,6 @@
 package handle
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
@@ -10,23 +9,25 @@ type MemoryStruct struct {
 	Free  float64 `json:"free"`
 }
 
-var Memory *MemoryStruct = &MemoryStruct{}
-
-func setMemory(mfs []*io_prometheus_client.MetricFamily) {
+func setMemory(mfs []*io_prometheus_client.MetricFamily, memory *MemoryStruct) {
 	for _, mf := range mfs {
 		for _, m := range mf.Metric {
 			if *mf.Name == "node_memory_MemFree_bytes" {
-				(*Memory).Free = *m.Gauge.Value
+				(*memory).Free = *m.Gauge.Value
 			}
 			if *mf.Name == "node_memory_MemTotal_bytes" {
-				(*Memory).Total = *m.Gauge.Value
+				(*memory).Total = *m.Gauge.Value
 			}
 		}
 	}
 }
 
-func HandleMemory(r *prometheus.Registry) {
-	if Collect, err := r.Gather(); err == nil {
-		setMemory(Collect)
-	}
+func init() {
+	registerModule("memory", defaultEnabled, []string{"meminfo"}, false, buildMemory)
+}
+
+func buildMemory(in *Input) (interface{}, error) {
+	var memory MemoryStruct
+	setMemory(in.Last, &memory)
+	return memory, nil
 }
@@ -0,0 +1,42 @@
+package handle
+
+import (
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestSetMemory(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mfs  []*io_prometheus_client.MetricFamily
+		want MemoryStruct
+	}{
+		{
+			name: "total and free",
+			mfs: []*io_prometheus_client.MetricFamily{
+				gauge("node_memory_MemTotal_bytes", sample{value: 8 << 30}),
+				gauge("node_memory_MemAvailable_bytes", sample{value: 6 << 30}),
+				gauge("node_memory_MemFree_bytes", sample{value: 2 << 30}),
+			},
+			want: MemoryStruct{Total: 8 << 30, Free: 2 << 30},
+		},
+		{
+			name: "missing free",
+			mfs:  []*io_prometheus_client.MetricFamily{gauge("node_memory_MemTotal_bytes", sample{value: 1024})},
+			want: MemoryStruct{Total: 1024},
+		},
+		{
+			name: "no meminfo",
+			want: MemoryStruct{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got MemoryStruct
+			setMemory(tc.mfs, &got)
+			if got != tc.want {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
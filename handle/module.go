@@ -0,0 +1,143 @@
+package handle
+
+import (
+	"fmt"
+	"go_collector/handle/status"
+	"sort"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+const (
+	defaultEnabled  = true
+	defaultDisabled = false
+)
+
+// RateInterval is the time between the two gathers handed to modules that
+// compute rates from counters.
+var RateInterval = kingpin.Flag(
+	"handle.rate-interval",
+	"Time between the two samples used by handle modules that compute rates.",
+).Default("1s").Duration()
+
+// Input is what a module builds its section from.
+type Input struct {
+	// Last is the most recent gather.
+	Last []*io_prometheus_client.MetricFamily
+	// Prev is a gather taken RateInterval before Last. It is nil unless an
+	// enabled module sets NeedsRate.
+	Prev []*io_prometheus_client.MetricFamily
+	// LastTime and PrevTime are when the gathers started. Rates are over
+	// the time between them, or over RateInterval when either is unknown.
+	LastTime time.Time
+	PrevTime time.Time
+	// Report records the external commands a module runs.
+	Report *status.Report
+}
+
+// BuildFunc turns the gathered metrics into a JSON-serialisable section.
+type BuildFunc func(in *Input) (interface{}, error)
+
+type module struct {
+	name       string
+	collectors []string
+	needsRate  bool
+	build      BuildFunc
+	enabled    *bool
+}
+
+var modules = make(map[string]*module)
+
+// registerModule adds a payload section named name, built by build from the
+// metrics of collectors. It is enabled by the --handle.<name> flag.
+func registerModule(name string, isDefaultEnabled bool, collectors []string, needsRate bool, build BuildFunc) {
+	if _, ok := modules[name]; ok {
+		panic(fmt.Sprintf("handle module %s registered twice", name))
+	}
+	var helpDefaultState string
+	if isDefaultEnabled {
+		helpDefaultState = "enabled"
+	} else {
+		helpDefaultState = "disabled"
+	}
+
+	flagName := fmt.Sprintf("handle.%s", name)
+	flagHelp := fmt.Sprintf("Enable the %s payload section (default: %s).", name, helpDefaultState)
+	defaultValue := fmt.Sprintf("%v", isDefaultEnabled)
+
+	modules[name] = &module{
+		name:       name,
+		collectors: collectors,
+		needsRate:  needsRate,
+		build:      build,
+		enabled:    kingpin.Flag(flagName, flagHelp).Default(defaultValue).Bool(),
+	}
+}
+
+// Registered reports whether a module named name exists.
+func Registered(name string) bool {
+	_, ok := modules[name]
+	return ok
+}
+
+// ModuleCollectors returns the collectors the module named name depends on.
+func ModuleCollectors(name string) []string {
+	if m, ok := modules[name]; ok {
+		return append([]string{}, m.collectors...)
+	}
+	return nil
+}
+
+func enabledModules() []*module {
+	enabled := []*module{}
+	for _, m := range modules {
+		if *m.enabled {
+			enabled = append(enabled, m)
+		}
+	}
+	sort.Slice(enabled, func(i, j int) bool { return enabled[i].name < enabled[j].name })
+	return enabled
+}
+
+// Collectors returns the sorted, de-duplicated collectors the enabled
+// modules depend on.
+func Collectors() []string {
+	seen := map[string]bool{}
+	collectors := []string{}
+	for _, m := range enabledModules() {
+		for _, c := range m.collectors {
+			if !seen[c] {
+				seen[c] = true
+				collectors = append(collectors, c)
+			}
+		}
+	}
+	sort.Strings(collectors)
+	return collectors
+}
+
+// NeedsRate reports whether any enabled module needs Input.Prev.
+func NeedsRate() bool {
+	for _, m := range enabledModules() {
+		if m.needsRate {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildPayload runs every enabled module and returns the sections keyed by
+// module name. Each module run is recorded in in.Report; a failed module
+// still contributes whatever partial section it returned.
+func BuildPayload(in *Input) map[string]interface{} {
+	payload := make(map[string]interface{})
+	for _, m := range enabledModules() {
+		begin := time.Now()
+		section, err := m.build(in)
+		in.Report.Add(status.KindHandle, m.name, time.Since(begin), err)
+		payload[m.name] = section
+	}
+	return payload
+}
@@ -0,0 +1,431 @@
+package handle
+
+import (
+	"encoding/json"
+	"go_collector/handle/status"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMain(m *testing.M) {
+	// Apply the flag defaults so that the default modules are enabled.
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+func family(name string, typ io_prometheus_client.MetricType, samples ...sample) *io_prometheus_client.MetricFamily {
+	mf := &io_prometheus_client.MetricFamily{Name: proto.String(name), Type: typ.Enum()}
+	for _, s := range samples {
+		m := &io_prometheus_client.Metric{}
+		// Gathered label pairs are sorted by name; the handle code relies on it.
+		names := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			m.Label = append(m.Label, &io_prometheus_client.LabelPair{Name: proto.String(k), Value: proto.String(s.labels[k])})
+		}
+		switch typ {
+		case io_prometheus_client.MetricType_COUNTER:
+			m.Counter = &io_prometheus_client.Counter{Value: proto.Float64(s.value)}
+		default:
+			m.Gauge = &io_prometheus_client.Gauge{Value: proto.Float64(s.value)}
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+	return mf
+}
+
+func counter(name string, samples ...sample) *io_prometheus_client.MetricFamily {
+	return family(name, io_prometheus_client.MetricType_COUNTER, samples...)
+}
+
+func gauge(name string, samples ...sample) *io_prometheus_client.MetricFamily {
+	return family(name, io_prometheus_client.MetricType_GAUGE, samples...)
+}
+
+func cpuSeconds(cpu string, idle, user float64) []sample {
+	return []sample{
+		{labels: map[string]string{"cpu": cpu, "mode": "idle"}, value: idle},
+		{labels: map[string]string{"cpu": cpu, "mode": "user"}, value: user},
+	}
+}
+
+func testInput() *Input {
+	prev := append(cpuSeconds("0", 100, 100), cpuSeconds("1", 100, 100)...)
+	last := append(cpuSeconds("0", 110, 110), cpuSeconds("1", 120, 100)...)
+	hwmon := []*io_prometheus_client.MetricFamily{
+		gauge("node_hwmon_sensor_label",
+			sample{labels: map[string]string{"chip": "platform_coretemp_0", "sensor": "temp2", "label": "Core 0"}, value: 1},
+			sample{labels: map[string]string{"chip": "platform_coretemp_0", "sensor": "temp3", "label": "Core 1"}, value: 1},
+		),
+		gauge("node_hwmon_temp_celsius",
+			sample{labels: map[string]string{"chip": "platform_coretemp_0", "sensor": "temp2"}, value: 41},
+			sample{labels: map[string]string{"chip": "platform_coretemp_0", "sensor": "temp3"}, value: 43.5},
+		),
+	}
+	memory := []*io_prometheus_client.MetricFamily{
+		gauge("node_memory_MemTotal_bytes", sample{value: 1024}),
+		gauge("node_memory_MemFree_bytes", sample{value: 512}),
+	}
+	network := []*io_prometheus_client.MetricFamily{
+		counter("node_network_receive_bytes_total", sample{labels: map[string]string{"device": "eth0"}, value: 10}),
+		counter("node_network_transmit_bytes_total", sample{labels: map[string]string{"device": "eth0"}, value: 20}),
+	}
+
+	in := &Input{
+		Prev:   []*io_prometheus_client.MetricFamily{counter("node_cpu_seconds_total", prev...)},
+		Last:   []*io_prometheus_client.MetricFamily{counter("node_cpu_seconds_total", last...)},
+		Report: status.NewReport(),
+	}
+	in.Last = append(in.Last, hwmon...)
+	in.Last = append(in.Last, memory...)
+	in.Last = append(in.Last, network...)
+	return in
+}
+
+// sectionSizes returns the number of entries of each list or map in the
+// payload that would grow if state leaked between runs.
+func sectionSizes(t *testing.T, payload map[string]interface{}) map[string]int {
+	t.Helper()
+	cpus := payload["cpus"].(CPUInfoStruct)
+	return map[string]int{
+		"cpus.usage":       len(cpus.Usage),
+		"cpus.temperature": len(cpus.Temperature),
+		"network":          len(payload["network"].(map[string]*InterfaceStruct)),
+	}
+}
+
+func TestBuildPayloadRepeated(t *testing.T) {
+	want := map[string]int{"cpus.usage": 2, "cpus.temperature": 2, "network": 1}
+
+	var first []byte
+	for i := 0; i < 3; i++ {
+		payload := BuildPayload(testInput())
+		got := sectionSizes(t, payload)
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("run %d: expected %d entries in %s, got %d", i, v, k, got[k])
+			}
+		}
+
+		delete(payload, "disks")
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b
+		} else if string(b) != string(first) {
+			t.Errorf("run %d produced a different payload:\n%s\nfirst run:\n%s", i, b, first)
+		}
+	}
+}
+
+func TestBuildPayloadConcurrent(t *testing.T) {
+	const runs = 8
+	sizes := make([]map[string]int, runs)
+	var wg sync.WaitGroup
+	wg.Add(runs)
+	for i := 0; i < runs; i++ {
+		go func(i int) {
+			defer wg.Done()
+			sizes[i] = sectionSizes(t, BuildPayload(testInput()))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < runs; i++ {
+		for k, v := range sizes[0] {
+			if sizes[i][k] != v {
+				t.Errorf("run %d: expected %d entries in %s, got %d", i, v, k, sizes[i][k])
+			}
+		}
+	}
+}
+
+func TestBuildPayloadRecordsModules(t *testing.T) {
+	in := testInput()
+	BuildPayload(in)
+
+	recorded := map[string]bool{}
+	for _, step := range in.Report.Steps() {
+		if step.Kind == status.KindHandle {
+			recorded[step.Name] = true
+		}
+	}
+	for _, m := range enabledModules() {
+		if !recorded[m.name] {
+			t.Errorf("module %s was not recorded in the report", m.name)
+		}
+	}
+}
+
+func TestBuildProcesses(t *testing.T) {
+	proc := func(name, pid string, value float64) sample {
+		return sample{labels: map[string]string{"name": name, "pid": pid}, value: value}
+	}
+	in := &Input{
+		Prev: []*io_prometheus_client.MetricFamily{
+			counter("node_process_cpu_seconds_total", proc("nginx", "10", 5), proc("sshd", "20", 8)),
+		},
+		Last: []*io_prometheus_client.MetricFamily{
+			counter("node_process_cpu_seconds_total", proc("nginx", "10", 5.5), proc("sshd", "20", 4), proc("cron", "30", 1)),
+			gauge("node_process_resident_memory_bytes", proc("nginx", "10", 4096), proc("sshd", "20", 2048), proc("cron", "30", 1024)),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildProcesses(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sshd went backwards (PID reuse) and cron has no previous sample, so
+	// the usage of both is unavailable and they come last, by memory.
+	want := `[{"name":"nginx","pid":"10","cpu":50,"rss":4096,"open_fds":0,"read_bytes":0,"write_bytes":0,"threads":0},` +
+		`{"name":"sshd","pid":"20","cpu":null,"rss":2048,"open_fds":0,"read_bytes":0,"write_bytes":0,"threads":0},` +
+		`{"name":"cron","pid":"30","cpu":null,"rss":1024,"open_fds":0,"read_bytes":0,"write_bytes":0,"threads":0}]`
+	if string(b) != want {
+		t.Errorf("unexpected processes section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildServices(t *testing.T) {
+	state := func(name, state string, value float64) sample {
+		return sample{labels: map[string]string{"name": name, "state": state, "type": "simple"}, value: value}
+	}
+	in := &Input{
+		Last: []*io_prometheus_client.MetricFamily{
+			gauge("node_systemd_units",
+				sample{labels: map[string]string{"state": "active"}, value: 40},
+				sample{labels: map[string]string{"state": "failed"}, value: 2},
+			),
+			gauge("node_systemd_unit_state",
+				state("nginx.service", "active", 1), state("nginx.service", "failed", 0),
+				state("backup.service", "active", 0), state("backup.service", "failed", 1),
+				state("backup.timer", "active", 1),
+			),
+			gauge("node_systemd_unit_sub_state",
+				sample{labels: map[string]string{"name": "nginx.service", "sub_state": "running"}, value: 1},
+				sample{labels: map[string]string{"name": "backup.service", "sub_state": "failed"}, value: 1},
+			),
+			counter("node_systemd_service_restart_total", sample{labels: map[string]string{"name": "nginx.service"}, value: 3}),
+			gauge("node_systemd_unit_start_time_seconds", sample{labels: map[string]string{"name": "nginx.service"}, value: 1700000000}),
+			gauge("node_systemd_unit_failed_since_seconds", sample{labels: map[string]string{"name": "backup.service"}, value: 1700000100}),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildServices(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"failed":2,"units":[` +
+		`{"name":"backup.service","active_state":"failed","sub_state":"failed","failed_since":1700000100},` +
+		`{"name":"nginx.service","active_state":"active","sub_state":"running","restarts":3,"start_time":1700000000}]}`
+	if string(b) != want {
+		t.Errorf("unexpected services section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildLogs(t *testing.T) {
+	file := map[string]string{"file": "/var/log/kern.log"}
+	match := func(pattern, line string, time float64) sample {
+		return sample{labels: map[string]string{"file": "/var/log/kern.log", "pattern": pattern, "line": line}, value: time}
+	}
+	in := &Input{
+		Last: []*io_prometheus_client.MetricFamily{
+			gauge("node_logwatch_file_readable", sample{labels: file, value: 1}),
+			counter("node_logwatch_matches_total",
+				sample{labels: map[string]string{"file": "/var/log/kern.log", "pattern": "io_error"}, value: 4},
+				sample{labels: map[string]string{"file": "/var/log/kern.log", "pattern": "oom"}, value: 0},
+			),
+			gauge("node_logwatch_sample_info",
+				match("io_error", "I/O error, dev sdb, sector 2048", 1700000100),
+				match("io_error", "I/O error, dev sda, sector 1024", 1700000000),
+			),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildLogs(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"/var/log/kern.log":{"readable":true,"patterns":{` +
+		`"io_error":{"matches":4,"samples":[{"time":1700000000,"line":"I/O error, dev sda, sector 1024"},{"time":1700000100,"line":"I/O error, dev sdb, sector 2048"}]},` +
+		`"oom":{"matches":0,"samples":[]}}}}`
+	if string(b) != want {
+		t.Errorf("unexpected logs section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildProbes(t *testing.T) {
+	labels := func(name, typ, target string) map[string]string {
+		return map[string]string{"probe": name, "type": typ, "target": target}
+	}
+	api := labels("api", "http", "https://api.example.com/health")
+	db := labels("db", "tcp", "10.0.0.5:5432")
+	in := &Input{
+		Last: []*io_prometheus_client.MetricFamily{
+			gauge("node_probe_success", sample{labels: api, value: 1}, sample{labels: db, value: 0}),
+			gauge("node_probe_duration_seconds", sample{labels: api, value: 0.25}, sample{labels: db, value: 5}),
+			gauge("node_probe_http_status_code", sample{labels: api, value: 200}),
+			gauge("node_probe_tls_cert_expiry_seconds", sample{labels: api, value: 1700000000}),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildProbes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"api","type":"http","target":"https://api.example.com/health","success":true,"duration_seconds":0.25,"status_code":200,"tls_expiry":1700000000},` +
+		`{"name":"db","type":"tcp","target":"10.0.0.5:5432","success":false,"duration_seconds":5}]`
+	if string(b) != want {
+		t.Errorf("unexpected probes section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildCertificates(t *testing.T) {
+	cert := func(file, serial string, value float64) sample {
+		return sample{labels: map[string]string{"file": file, "serial": serial, "subject": "CN=" + serial, "issuer": "CN=ca", "dns_names": serial + ".example.com"}, value: value}
+	}
+	in := &Input{
+		Last: []*io_prometheus_client.MetricFamily{
+			gauge("node_certfile_file_error",
+				sample{labels: map[string]string{"file": "/etc/ssl/web.pem"}, value: 0},
+				sample{labels: map[string]string{"file": "/etc/ssl/broken.pem"}, value: 1},
+			),
+			gauge("node_certfile_not_after_seconds", cert("/etc/ssl/web.pem", "a", 1700000000), cert("/etc/ssl/web.pem", "b", 1600000000)),
+			gauge("node_certfile_days_remaining", cert("/etc/ssl/web.pem", "a", 30), cert("/etc/ssl/web.pem", "b", -1127)),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildCertificates(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"certificates":[` +
+		`{"file":"/etc/ssl/web.pem","serial":"b","subject":"CN=b","issuer":"CN=ca","dns_names":["b.example.com"],"not_after":1600000000,"days_remaining":-1127},` +
+		`{"file":"/etc/ssl/web.pem","serial":"a","subject":"CN=a","issuer":"CN=ca","dns_names":["a.example.com"],"not_after":1700000000,"days_remaining":30}],` +
+		`"errors":["/etc/ssl/broken.pem"]}`
+	if string(b) != want {
+		t.Errorf("unexpected certificates section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildSockets(t *testing.T) {
+	listening := func(protocol, address, port, process, pid string) sample {
+		return sample{labels: map[string]string{"protocol": protocol, "address": address, "port": port, "process": process, "pid": pid}, value: 1}
+	}
+	connections := func(direction, remote, port string, value float64) sample {
+		return sample{labels: map[string]string{"direction": direction, "remote_address": remote, "port": port}, value: value}
+	}
+	in := &Input{
+		Last: []*io_prometheus_client.MetricFamily{
+			gauge("node_sockets_listening",
+				listening("udp", "0.0.0.0", "53", "", ""),
+				listening("tcp", "0.0.0.0", "22", "sshd", "812"),
+			),
+			gauge("node_sockets_established_connections",
+				connections("inbound", "10.0.0.9", "22", 2),
+				connections("outbound", "10.0.1.2", "5432", 3),
+			),
+		},
+		Report: status.NewReport(),
+	}
+
+	got, err := buildSockets(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"listening":[` +
+		`{"protocol":"tcp","address":"0.0.0.0","port":22,"process":"sshd","pid":"812"},` +
+		`{"protocol":"udp","address":"0.0.0.0","port":53,"process":"","pid":""}],` +
+		`"established":[` +
+		`{"direction":"outbound","remote_address":"10.0.1.2","port":5432,"count":3},` +
+		`{"direction":"inbound","remote_address":"10.0.0.9","port":22,"count":2}]}`
+	if string(b) != want {
+		t.Errorf("unexpected sockets section:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestBuildCustom(t *testing.T) {
+	defer func(enabled bool) { *modules["custom"].enabled = enabled }(*modules["custom"].enabled)
+	*modules["custom"].enabled = true
+
+	script := func(name string, value float64) sample {
+		return sample{labels: map[string]string{"script": name}, value: value}
+	}
+	in := testInput()
+	in.Last = append(in.Last,
+		gauge("node_script_success", script("queue", 1)),
+		gauge("node_script_duration_seconds", script("queue", 0.5)),
+		gauge("app_queue_depth", script("queue", 7), script("queue", math.NaN())),
+		counter("app_jobs_total", script("queue", math.Inf(1))),
+		// A script label printed by the script itself, and one of another
+		// collector.
+		gauge("app_backlog", sample{labels: map[string]string{"script": "queue", "exported_script": "backup"}, value: 3}),
+		gauge("node_systemd_unit_state", script("backup", 1)),
+	)
+	// NaN and infinities are valid script output but not valid JSON.
+	b, err := json.Marshal(BuildPayload(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Custom json.RawMessage `json:"custom"`
+	}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"queue":{"success":true,"duration_seconds":0.5,"metrics":[` +
+		`{"name":"app_backlog","type":"gauge","labels":{"script":"backup"},"value":3},` +
+		`{"name":"app_jobs_total","type":"counter","labels":{},"value":null},` +
+		`{"name":"app_queue_depth","type":"gauge","labels":{},"value":7},` +
+		`{"name":"app_queue_depth","type":"gauge","labels":{},"value":null}]}}`
+	if string(payload.Custom) != want {
+		t.Errorf("unexpected custom section:\n%s\nwant:\n%s", payload.Custom, want)
+	}
+}
@@ -1,37 +1,38 @@
 package handle
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 type InterfaceStruct struct {
 	Receive  float64 `json:"receive"`
 	Transmit float64 `json:"transmit"`
+	// ReceiveRate and TransmitRate are in bytes per second over the rate
+	// interval, null when unavailable.
+	ReceiveRate  *float64 `json:"receive_rate"`
+	TransmitRate *float64 `json:"transmit_rate"`
 }
 
-var Network map[string]*InterfaceStruct = map[string]*InterfaceStruct{}
-
-func setNetwork(mfs []*io_prometheus_client.MetricFamily) {
+func setNetwork(mfs []*io_prometheus_client.MetricFamily, network map[string]*InterfaceStruct) {
 	for _, mf := range mfs {
 		for _, m := range mf.Metric {
 			if *mf.Name == "node_network_receive_bytes_total" {
 				for _, lp := range m.Label {
 					if *lp.Name == "device" {
-						if _, ok := Network[*lp.Value]; !ok {
-							Network[*lp.Value] = &InterfaceStruct{}
+						if _, ok := network[*lp.Value]; !ok {
+							network[*lp.Value] = &InterfaceStruct{}
 						}
-						Network[*lp.Value].Receive = *m.Counter.Value
+						network[*lp.Value].Receive = *m.Counter.Value
 					}
 				}
 			}
 			if *mf.Name == "node_network_transmit_bytes_total" {
 				for _, lp := range m.Label {
 					if *lp.Name == "device" {
-						if _, ok := Network[*lp.Value]; !ok {
-							Network[*lp.Value] = &InterfaceStruct{}
+						if _, ok := network[*lp.Value]; !ok {
+							network[*lp.Value] = &InterfaceStruct{}
 						}
-						Network[*lp.Value].Transmit = *m.Counter.Value
+						network[*lp.Value].Transmit = *m.Counter.Value
 					}
 				}
 			}
@@ -39,8 +40,23 @@ func setNetwork(mfs []*io_prometheus_client.MetricFamily) {
 	}
 }
 
-func HandleNetwork(r *prometheus.Registry) {
-	if Collect, err := r.Gather(); err == nil {
-		setNetwork(Collect)
+func init() {
+	registerModule("network", defaultEnabled, []string{"netdev"}, true, buildNetwork)
+}
+
+func buildNetwork(in *Input) (interface{}, error) {
+	network := map[string]*InterfaceStruct{}
+	setNetwork(in.Last, network)
+	prev := map[string]*InterfaceStruct{}
+	setNetwork(in.Prev, prev)
+	interval := in.interval()
+	for device, iface := range network {
+		before, ok := prev[device]
+		if !ok {
+			before = &InterfaceStruct{}
+		}
+		iface.ReceiveRate = available(counterRate(before.Receive, iface.Receive, ok, interval))
+		iface.TransmitRate = available(counterRate(before.Transmit, iface.Transmit, ok, interval))
 	}
+	return network, nil
 }
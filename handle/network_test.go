@@ -0,0 +1,91 @@
+package handle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestSetNetwork(t *testing.T) {
+	device := func(name string, value float64) sample {
+		return sample{labels: map[string]string{"device": name}, value: value}
+	}
+	for _, tc := range []struct {
+		name string
+		mfs  []*io_prometheus_client.MetricFamily
+		want map[string]*InterfaceStruct
+	}{
+		{
+			name: "both directions",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_network_receive_bytes_total", device("eth0", 10), device("lo", 5)),
+				counter("node_network_transmit_bytes_total", device("eth0", 20), device("lo", 5)),
+			},
+			want: map[string]*InterfaceStruct{
+				"eth0": {Receive: 10, Transmit: 20},
+				"lo":   {Receive: 5, Transmit: 5},
+			},
+		},
+		{
+			name: "one direction",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_network_transmit_bytes_total", device("tun0", 20)),
+			},
+			want: map[string]*InterfaceStruct{"tun0": {Transmit: 20}},
+		},
+		{
+			name: "other families ignored",
+			mfs: []*io_prometheus_client.MetricFamily{
+				counter("node_network_receive_packets_total", device("eth0", 1)),
+				counter("node_network_receive_bytes_total", device("eth0", 10)),
+			},
+			want: map[string]*InterfaceStruct{"eth0": {Receive: 10}},
+		},
+		{
+			name: "no devices",
+			want: map[string]*InterfaceStruct{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := map[string]*InterfaceStruct{}
+			setNetwork(tc.mfs, got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildNetwork(t *testing.T) {
+	device := func(name string, value float64) sample {
+		return sample{labels: map[string]string{"device": name}, value: value}
+	}
+	in := &Input{
+		Prev: []*io_prometheus_client.MetricFamily{
+			counter("node_network_receive_bytes_total", device("eth0", 1000), device("eth1", 5000)),
+			counter("node_network_transmit_bytes_total", device("eth0", 2000), device("eth1", 5000)),
+		},
+		Last: []*io_prometheus_client.MetricFamily{
+			counter("node_network_receive_bytes_total", device("eth0", 1500), device("eth1", 10), device("tun0", 10)),
+			counter("node_network_transmit_bytes_total", device("eth0", 2000), device("eth1", 5100), device("tun0", 10)),
+		},
+	}
+
+	got, err := buildNetwork(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// eth1 was reset by a driver reload and tun0 came up within the interval.
+	want := `{"eth0":{"receive":1500,"transmit":2000,"receive_rate":500,"transmit_rate":0},` +
+		`"eth1":{"receive":10,"transmit":5100,"receive_rate":null,"transmit_rate":100},` +
+		`"tun0":{"receive":10,"transmit":10,"receive_rate":null,"transmit_rate":null}}`
+	if string(b) != want {
+		t.Errorf("unexpected network section:\n%s\nwant:\n%s", b, want)
+	}
+}
@@ -0,0 +1,29 @@
+package handle
+
+import (
+	diskHandle "go_collector/handle/disk"
+	"go_collector/handle/status"
+)
+
+// RequiredSections are the sections every payload carries, whatever the
+// enabled modules.
+var RequiredSections = []string{"memory", "cpus", "disks", "network"}
+
+// CollectDataStruct describes the sections of the pushed payload produced by
+// the built-in modules. The payload itself is assembled by BuildPayload.
+type CollectDataStruct struct {
+	Memory       MemoryStruct                `json:"memory"`
+	CPUs         CPUInfoStruct               `json:"cpus"`
+	Disks        []diskHandle.DiskInfo       `json:"disks"`
+	Network      map[string]*InterfaceStruct `json:"network"`
+	DiskIO       map[string]*DiskIOStruct    `json:"disk_io,omitempty"`
+	Services     *ServicesStruct             `json:"services,omitempty"`
+	Custom       map[string]*CustomScript    `json:"custom,omitempty"`
+	Logs         map[string]*LogFileStruct   `json:"logs,omitempty"`
+	Kernel       *KernelStruct               `json:"kernel,omitempty"`
+	Certificates *CertificatesStruct         `json:"certificates,omitempty"`
+	Probes       []ProbeStruct               `json:"probes,omitempty"`
+	Processes    []ProcessStruct             `json:"processes,omitempty"`
+	Sockets      *SocketsStruct              `json:"sockets,omitempty"`
+	Status       []status.Step               `json:"status"`
+}
@@ -0,0 +1,60 @@
+package handle
+
+import (
+	"sort"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// ProbeStruct is the outcome of a reachability probe run by the agent.
+type ProbeStruct struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Target     string  `json:"target"`
+	Success    bool    `json:"success"`
+	Duration   float64 `json:"duration_seconds"`
+	StatusCode int     `json:"status_code,omitempty"`
+	// TLSExpiry is the expiry time of the server certificate since unix
+	// epoch in seconds.
+	TLSExpiry float64 `json:"tls_expiry,omitempty"`
+}
+
+func init() {
+	registerModule("probes", defaultDisabled, []string{"probe"}, false, buildProbes)
+}
+
+func setProbes(mfs []*io_prometheus_client.MetricFamily, probes map[string]*ProbeStruct) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			name := labelValue(m, "probe")
+			p, ok := probes[name]
+			if !ok {
+				p = &ProbeStruct{Name: name, Type: labelValue(m, "type"), Target: labelValue(m, "target")}
+			}
+			switch mf.GetName() {
+			case "node_probe_success":
+				p.Success = m.GetGauge().GetValue() == 1
+			case "node_probe_duration_seconds":
+				p.Duration = m.GetGauge().GetValue()
+			case "node_probe_http_status_code":
+				p.StatusCode = int(m.GetGauge().GetValue())
+			case "node_probe_tls_cert_expiry_seconds":
+				p.TLSExpiry = m.GetGauge().GetValue()
+			default:
+				continue
+			}
+			probes[name] = p
+		}
+	}
+}
+
+func buildProbes(in *Input) (interface{}, error) {
+	byName := map[string]*ProbeStruct{}
+	setProbes(in.Last, byName)
+	probes := make([]ProbeStruct, 0, len(byName))
+	for _, p := range byName {
+		probes = append(probes, *p)
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Name < probes[j].Name })
+	return probes, nil
+}
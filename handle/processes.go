@@ -0,0 +1,129 @@
+package handle
+
+import (
+	"sort"
+
+	"github.com/alecthomas/kingpin/v2"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+var processesTopN = kingpin.Flag(
+	"handle.processes.top-n",
+	"Number of processes, or process groups, with the highest CPU usage reported in the processes section.",
+).Default("10").Int()
+
+// ProcessStruct is the resource usage of a process, or of a process group
+// when the process collector is configured with groups.
+type ProcessStruct struct {
+	Name  string `json:"name"`
+	PID   string `json:"pid,omitempty"`
+	Group string `json:"group,omitempty"`
+	// CPU is the usage over the rate interval in percent of one core, null
+	// when unavailable.
+	CPU        *float64 `json:"cpu"`
+	RSS        float64  `json:"rss"`
+	OpenFDs    float64  `json:"open_fds"`
+	ReadBytes  float64  `json:"read_bytes"`
+	WriteBytes float64  `json:"write_bytes"`
+	Threads    float64  `json:"threads"`
+	Count      float64  `json:"count,omitempty"`
+}
+
+func init() {
+	registerModule("processes", defaultDisabled, []string{"process"}, true, buildProcesses)
+}
+
+// processKey identifies a process, or group, by its labels.
+func processKey(m *io_prometheus_client.Metric) (key string, labels map[string]string) {
+	labels = map[string]string{}
+	for _, lp := range m.Label {
+		labels[lp.GetName()] = lp.GetValue()
+		key += lp.GetName() + "=" + lp.GetValue() + ","
+	}
+	return key, labels
+}
+
+func setProcesses(mfs []*io_prometheus_client.MetricFamily, processes map[string]*ProcessStruct) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			var value *float64
+			key, labels := processKey(m)
+			p, ok := processes[key]
+			if !ok {
+				p = &ProcessStruct{Name: labels["name"], PID: labels["pid"], Group: labels["group"]}
+				if p.Name == "" {
+					p.Name = p.Group
+				}
+			}
+			switch mf.GetName() {
+			case "node_process_cpu_seconds_total":
+				// Seconds until the rate is computed in buildProcesses.
+				p.CPU = new(float64)
+				value = p.CPU
+			case "node_process_resident_memory_bytes":
+				value = &p.RSS
+			case "node_process_open_fds":
+				value = &p.OpenFDs
+			case "node_process_io_read_bytes_total":
+				value = &p.ReadBytes
+			case "node_process_io_write_bytes_total":
+				value = &p.WriteBytes
+			case "node_process_threads":
+				value = &p.Threads
+			case "node_process_count":
+				value = &p.Count
+			default:
+				continue
+			}
+			if m.Counter != nil {
+				*value = m.Counter.GetValue()
+			} else {
+				*value = m.Gauge.GetValue()
+			}
+			processes[key] = p
+		}
+	}
+}
+
+func buildProcesses(in *Input) (interface{}, error) {
+	prev := map[string]*ProcessStruct{}
+	last := map[string]*ProcessStruct{}
+	setProcesses(in.Prev, prev)
+	setProcesses(in.Last, last)
+
+	processes := make([]ProcessStruct, 0, len(last))
+	interval := in.interval()
+	for key, p := range last {
+		// A process without a previous sample started within the interval;
+		// a decrease means the PID was reused. The usage of either is
+		// unavailable.
+		var prevCPU, lastCPU float64
+		before, ok := prev[key]
+		ok = ok && before.CPU != nil && p.CPU != nil
+		if ok {
+			prevCPU, lastCPU = *before.CPU, *p.CPU
+		}
+		cpu, ok := counterRate(prevCPU, lastCPU, ok, interval)
+		p.CPU = available(cpu*100, ok)
+		processes = append(processes, *p)
+	}
+
+	// Processes whose usage is unavailable come last.
+	sort.Slice(processes, func(i, j int) bool {
+		a, b := processes[i].CPU, processes[j].CPU
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		if a != nil && *a != *b {
+			return *a > *b
+		}
+		if processes[i].RSS != processes[j].RSS {
+			return processes[i].RSS > processes[j].RSS
+		}
+		return processes[i].Name+processes[i].PID < processes[j].Name+processes[j].PID
+	})
+	if n := *processesTopN; n >= 0 && len(processes) > n {
+		processes = processes[:n]
+	}
+	return processes, nil
+}
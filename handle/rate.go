@@ -0,0 +1,74 @@
+package handle
+
+import (
+	"math"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// counterDelta returns how much a counter grew between two samples. ok is
+// false when there is no previous sample, because the counter appeared
+// within the interval (hotplug, new device or process), or when the counter
+// went backwards, because it was reset or wrapped around.
+func counterDelta(prev, last float64, hasPrev bool) (delta float64, ok bool) {
+	if !hasPrev || math.IsNaN(prev) || math.IsNaN(last) || last < prev {
+		return 0, false
+	}
+	return last - prev, true
+}
+
+// counterRate returns the per second increase of a counter sampled interval
+// apart, see counterDelta.
+func counterRate(prev, last float64, hasPrev bool, interval time.Duration) (rate float64, ok bool) {
+	delta, ok := counterDelta(prev, last, hasPrev)
+	if !ok || interval <= 0 {
+		return 0, false
+	}
+	return delta / interval.Seconds(), true
+}
+
+// interval returns the time between Prev and Last, see Input.
+func (in *Input) interval() time.Duration {
+	if in.LastTime.IsZero() || in.PrevTime.IsZero() {
+		return *RateInterval
+	}
+	return in.LastTime.Sub(in.PrevTime)
+}
+
+// ratio returns part/whole clamped to [0, 1], as counters sampled at
+// slightly different times can make a part outgrow its whole. ok is false
+// when whole did not grow.
+func ratio(part, whole float64) (r float64, ok bool) {
+	if !(whole > 0) || math.IsNaN(part) || math.IsInf(whole, 0) {
+		return 0, false
+	}
+	return math.Min(math.Max(part/whole, 0), 1), true
+}
+
+// available returns &v, or nil, marshalled as null, when v is unavailable.
+func available(v float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// counterValues returns the samples of the metric family called name keyed
+// by the value of their label.
+func counterValues(mfs []*io_prometheus_client.MetricFamily, name, label string) map[string]float64 {
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == label {
+					values[lp.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
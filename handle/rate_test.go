@@ -0,0 +1,56 @@
+package handle
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterRate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		prev, last float64
+		hasPrev    bool
+		interval   time.Duration
+		want       float64
+		ok         bool
+	}{
+		{name: "increase", prev: 100, last: 300, hasPrev: true, interval: 2 * time.Second, want: 100, ok: true},
+		{name: "unchanged", prev: 100, last: 100, hasPrev: true, interval: time.Second, want: 0, ok: true},
+		{name: "no previous sample", last: 300, interval: time.Second},
+		{name: "reset", prev: 300, last: 5, hasPrev: true, interval: time.Second},
+		{name: "wraparound", prev: math.MaxUint32, last: 10, hasPrev: true, interval: time.Second},
+		{name: "not a number", prev: math.NaN(), last: 10, hasPrev: true, interval: time.Second},
+		{name: "no interval", prev: 100, last: 300, hasPrev: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := counterRate(tc.prev, tc.last, tc.hasPrev, tc.interval)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("want %v, %v, got %v, %v", tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestRatio(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		part, whole float64
+		want        float64
+		ok          bool
+	}{
+		{name: "half", part: 1, whole: 2, want: 0.5, ok: true},
+		{name: "outgrown whole", part: 2.01, whole: 2, want: 1, ok: true},
+		{name: "negative part", part: -1, whole: 2, want: 0, ok: true},
+		{name: "zero whole", part: 0, whole: 0},
+		{name: "not a number", part: math.NaN(), whole: 2},
+		{name: "infinite whole", part: 1, whole: math.Inf(1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := ratio(tc.part, tc.whole)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("want %v, %v, got %v, %v", tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handle
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/alecthomas/kingpin/v2"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+var servicesInclude = kingpin.Flag(
+	"handle.services.include",
+	"Regexp of systemd units listed in the services section, applied on top of --collector.systemd.unit-include.",
+).Default(`.+\.service`).String()
+
+// ServiceStruct is the state of a watched systemd unit. Restarts and
+// StartTime are only set with --collector.systemd.enable-restarts-metrics and
+// --collector.systemd.enable-start-time-metrics.
+type ServiceStruct struct {
+	Name        string   `json:"name"`
+	ActiveState string   `json:"active_state"`
+	SubState    string   `json:"sub_state"`
+	Restarts    *float64 `json:"restarts,omitempty"`
+	StartTime   float64  `json:"start_time,omitempty"`
+	FailedSince float64  `json:"failed_since,omitempty"`
+}
+
+type ServicesStruct struct {
+	// Failed is the number of failed units, watched or not.
+	Failed float64         `json:"failed"`
+	Units  []ServiceStruct `json:"units"`
+}
+
+func init() {
+	registerModule("services", defaultDisabled, []string{"systemd"}, false, buildServices)
+}
+
+func labelValue(m *io_prometheus_client.Metric, name string) string {
+	for _, lp := range m.Label {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
+
+func setServices(mfs []*io_prometheus_client.MetricFamily, include *regexp.Regexp, services *ServicesStruct) {
+	units := map[string]*ServiceStruct{}
+	unit := func(name string) *ServiceStruct {
+		if _, ok := units[name]; !ok {
+			units[name] = &ServiceStruct{Name: name}
+		}
+		return units[name]
+	}
+
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			if mf.GetName() == "node_systemd_units" {
+				if labelValue(m, "state") == "failed" {
+					services.Failed = m.GetGauge().GetValue()
+				}
+				continue
+			}
+			name := labelValue(m, "name")
+			if name == "" || !include.MatchString(name) {
+				continue
+			}
+			switch mf.GetName() {
+			case "node_systemd_unit_state":
+				if m.GetGauge().GetValue() == 1 {
+					unit(name).ActiveState = labelValue(m, "state")
+				}
+			case "node_systemd_unit_sub_state":
+				unit(name).SubState = labelValue(m, "sub_state")
+			case "node_systemd_service_restart_total":
+				restarts := m.GetCounter().GetValue()
+				unit(name).Restarts = &restarts
+			case "node_systemd_unit_start_time_seconds":
+				unit(name).StartTime = m.GetGauge().GetValue()
+			case "node_systemd_unit_failed_since_seconds":
+				unit(name).FailedSince = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	services.Units = make([]ServiceStruct, 0, len(units))
+	for _, u := range units {
+		services.Units = append(services.Units, *u)
+	}
+	sort.Slice(services.Units, func(i, j int) bool { return services.Units[i].Name < services.Units[j].Name })
+}
+
+func buildServices(in *Input) (interface{}, error) {
+	include, err := regexp.Compile("^(?:" + *servicesInclude + ")$")
+	if err != nil {
+		return ServicesStruct{Units: []ServiceStruct{}}, err
+	}
+	var services ServicesStruct
+	setServices(in.Last, include, &services)
+	return services, nil
+}
@@ -0,0 +1,92 @@
+package handle
+
+import (
+	"sort"
+	"strconv"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// ListeningSocketStruct is a listening TCP socket or an unconnected UDP
+// socket. Process and PID are empty when the owner could not be found.
+type ListeningSocketStruct struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Process  string `json:"process"`
+	PID      string `json:"pid"`
+}
+
+// ConnectionStruct counts the established TCP connections with a peer.
+// Port is the local port of inbound connections and the remote port of
+// outbound ones.
+type ConnectionStruct struct {
+	Direction     string  `json:"direction"`
+	RemoteAddress string  `json:"remote_address"`
+	Port          int     `json:"port"`
+	Count         float64 `json:"count"`
+}
+
+// SocketsStruct is the inventory of listening sockets and established
+// connections.
+type SocketsStruct struct {
+	Listening   []ListeningSocketStruct `json:"listening"`
+	Established []ConnectionStruct      `json:"established"`
+}
+
+func init() {
+	registerModule("sockets", defaultDisabled, []string{"sockets"}, false, buildSockets)
+}
+
+func setSockets(mfs []*io_prometheus_client.MetricFamily, sockets *SocketsStruct) {
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "node_sockets_listening":
+			for _, m := range mf.Metric {
+				port, _ := strconv.Atoi(labelValue(m, "port"))
+				sockets.Listening = append(sockets.Listening, ListeningSocketStruct{
+					Protocol: labelValue(m, "protocol"),
+					Address:  labelValue(m, "address"),
+					Port:     port,
+					Process:  labelValue(m, "process"),
+					PID:      labelValue(m, "pid"),
+				})
+			}
+		case "node_sockets_established_connections":
+			for _, m := range mf.Metric {
+				port, _ := strconv.Atoi(labelValue(m, "port"))
+				sockets.Established = append(sockets.Established, ConnectionStruct{
+					Direction:     labelValue(m, "direction"),
+					RemoteAddress: labelValue(m, "remote_address"),
+					Port:          port,
+					Count:         m.GetGauge().GetValue(),
+				})
+			}
+		}
+	}
+
+	sort.Slice(sockets.Listening, func(i, j int) bool {
+		a, b := sockets.Listening[i], sockets.Listening[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Protocol+a.Address < b.Protocol+b.Address
+	})
+	// Busiest peers first.
+	sort.Slice(sockets.Established, func(i, j int) bool {
+		a, b := sockets.Established[i], sockets.Established[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Direction+a.RemoteAddress != b.Direction+b.RemoteAddress {
+			return a.Direction+a.RemoteAddress < b.Direction+b.RemoteAddress
+		}
+		return a.Port < b.Port
+	})
+}
+
+func buildSockets(in *Input) (interface{}, error) {
+	sockets := SocketsStruct{Listening: []ListeningSocketStruct{}, Established: []ConnectionStruct{}}
+	setSockets(in.Last, &sockets)
+	return sockets, nil
+}
@@ -0,0 +1,97 @@
+// Package status records the outcome of every step of a collection run so
+// that it can be reported alongside the collected data.
+package status
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of steps recorded in a Report.
+const (
+	KindCollector = "collector"
+	KindHandle    = "handle"
+	KindCommand   = "command"
+	KindTool      = "tool"
+	KindPush      = "push"
+)
+
+// Step is the outcome of a single collector, handle or command run, of the
+// lookup of a tool, or of the push of a payload section.
+type Step struct {
+	Kind     string  `json:"kind"`
+	Name     string  `json:"name"`
+	Success  bool    `json:"success"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+	// Path and Version are where a tool was found and its version.
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Report collects steps. It is safe for concurrent use.
+type Report struct {
+	mtx   sync.Mutex
+	steps []Step
+}
+
+// NewReport returns an empty Report.
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Add records a finished step.
+func (r *Report) Add(kind, name string, duration time.Duration, err error) {
+	r.add(newStep(kind, name, duration, err))
+}
+
+// AddTool records the lookup of a tool, found at path unless err is set.
+func (r *Report) AddTool(name, path, version string, duration time.Duration, err error) {
+	step := newStep(KindTool, name, duration, err)
+	step.Path, step.Version = path, version
+	r.add(step)
+}
+
+func newStep(kind, name string, duration time.Duration, err error) Step {
+	step := Step{
+		Kind:     kind,
+		Name:     name,
+		Success:  err == nil,
+		Duration: duration.Seconds(),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	return step
+}
+
+func (r *Report) add(step Step) {
+	r.mtx.Lock()
+	r.steps = append(r.steps, step)
+	r.mtx.Unlock()
+}
+
+// Time runs fn and records its duration and error as a step.
+func (r *Report) Time(kind, name string, fn func() error) error {
+	begin := time.Now()
+	err := fn()
+	r.Add(kind, name, time.Since(begin), err)
+	return err
+}
+
+// Steps returns the recorded steps ordered by kind and name.
+func (r *Report) Steps() []Step {
+	r.mtx.Lock()
+	steps := make([]Step, len(r.steps))
+	copy(steps, r.steps)
+	r.mtx.Unlock()
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].Kind != steps[j].Kind {
+			return steps[i].Kind < steps[j].Kind
+		}
+		return steps[i].Name < steps[j].Name
+	})
+	return steps
+}
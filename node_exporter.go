@@ -14,29 +14,32 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
+	"go_collector/bin"
+	"go_collector/capture"
 	"go_collector/collector"
+	"go_collector/config"
 	"go_collector/handle"
-	diskHandle "go_collector/handle/disk"
+	"go_collector/handle/status"
+	"go_collector/push"
 	"go_collector/utils"
-	"io"
-	"net/http"
+	"go_collector/utils/ttar"
 	_ "net/http/pprof"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/common/promlog"
-	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
 )
 
@@ -55,15 +58,7 @@ var filters = []string{
 	"hwmon",
 }
 
-type CollectDataStruct struct {
-	Memory  handle.MemoryStruct                `json:"memory"`
-	CPUs    handle.CPUInfoStruct               `json:"cpus"`
-	Disks   []diskHandle.DiskInfo              `json:"disks"`
-	Network map[string]*handle.InterfaceStruct `json:"network"`
-}
-
 func main() {
-	utils.BuildLogger("debug")
 	var (
 		disableDefaultCollectors = kingpin.Flag(
 			"collector.disable-defaults",
@@ -72,22 +67,60 @@ func main() {
 		maxProcs = kingpin.Flag(
 			"runtime.gomaxprocs", "The target number of CPUs Go will run on (GOMAXPROCS)",
 		).Envar("GOMAXPROCS").Default("1").Int()
+		fixturesDir = kingpin.Flag(
+			"fixtures.dir", "Collect from the host snapshot in this directory or .ttar file (proc, sys, udev/data, and recorded command outputs in commands) and print the payload instead of sending it.",
+		).Default("").String()
+
+		collectCmd = kingpin.Command("collect", "Collect once and send the payload.").Default()
+		captureCmd = kingpin.Command("capture", "Archive what the enabled collectors read and the outputs of the commands they run as a ttar snapshot for --fixtures.dir.")
+		captureOut = captureCmd.Flag("output", "Path of the snapshot written.").Short('o').Default("capture.ttar").String()
 	)
 
-	r := prometheus.NewRegistry()
-	// r.MustRegister(promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}), promcollectors.NewGoCollector())
+	// 加载.env文件, 其中的 HOST 与 CONFIG_URL 在解析参数前生效
+	envErr := godotenv.Load()
 
-	promlogConfig := &promlog.Config{}
-	flag.AddFlags(kingpin.CommandLine, promlogConfig)
+	logConfig := &utils.LogConfig{}
+	utils.AddLogFlags(kingpin.CommandLine, logConfig)
 	kingpin.Version(version.Print("node_exporter"))
 	kingpin.CommandLine.UsageWriter(os.Stdout)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
-	logger := promlog.New(promlogConfig)
+	command := kingpin.Parse()
+	logger, err := utils.NewLogger(logConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	utils.SetLogger(logger)
+	if envErr != nil {
+		level.Debug(logger).Log("msg", "No .env file loaded", "err", envErr)
+	}
 
 	if *disableDefaultCollectors {
 		collector.DisableDefaultCollectors()
 	}
+	collectors := filters
+	if f := config.NewFetcher(kingpin.CommandLine); f != nil {
+		if c := remoteConfig(logger, f); c != nil {
+			collectors = c
+		}
+	}
+	fixtures := *fixturesDir != ""
+	if fixtures {
+		dir, cleanup, err := fixturesRoot(*fixturesDir)
+		if err != nil {
+			level.Error(logger).Log("msg", "Couldn't open the snapshot", "path", *fixturesDir, "err", err)
+			os.Exit(1)
+		}
+		defer cleanup()
+		collector.UseFixtures(dir)
+		bin.Replay(filepath.Join(dir, "commands"))
+	}
+	var recorder *bin.RecordingRunner
+	if command == captureCmd.FullCommand() {
+		recorder = &bin.RecordingRunner{Runner: bin.ExecRunner{}}
+		restore := bin.SetRunner(recorder)
+		defer restore()
+	}
 	level.Info(logger).Log("msg", "Starting node_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 	if user, err := user.Current(); err == nil && user.Uid == "0" {
@@ -96,13 +129,14 @@ func main() {
 	runtime.GOMAXPROCS(*maxProcs)
 	level.Debug(logger).Log("msg", "Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
 
-	nc, err := collector.NewNodeCollector(logger, filters...)
+	nc, err := collector.NewNodeCollector(logger, append(collectors, handle.Collectors()...)...)
 	if err != nil {
-		level.Error(logger).Log("couldn't create collector: %s", err)
+		level.Error(logger).Log("msg", "Couldn't create collector", "err", err)
+		os.Exit(1)
 	}
 
 	level.Info(logger).Log("msg", "Enabled collectors")
-	collectors := []string{}
+	collectors = []string{}
 	for n := range nc.Collectors {
 		collectors = append(collectors, n)
 	}
@@ -110,140 +144,183 @@ func main() {
 	for _, c := range collectors {
 		level.Info(logger).Log("collector", c)
 	}
-	if err := r.Register(nc); err != nil {
-		level.Error(logger).Log("couldn't register node collector: %s", err)
-	}
 
-	if mfs, err := r.Gather(); err != nil {
+	collectData, err := collect(logger, nc, fixtures)
+	if err != nil {
 		level.Error(logger).Log("err", err)
-	} else {
-		// 将指标转换为 JSON 格式
-		var result []map[string]interface{}
-
-		for _, mf := range mfs {
-			for _, m := range mf.Metric {
-				metric := make(map[string]interface{})
-				metric["name"] = *mf.Name
-				metric["help"] = *mf.Help
-				metric["type"] = mf.Type.String()
-
-				labels := make(map[string]string)
-				for _, lp := range m.Label {
-					labels[*lp.Name] = *lp.Value
-				}
-				metric["labels"] = labels
-
-				switch {
-				case m.Gauge != nil:
-					metric["value"] = *m.Gauge.Value
-				case m.Counter != nil:
-					metric["value"] = *m.Counter.Value
-				case m.Summary != nil:
-					metric["count"] = *m.Summary.SampleCount
-					metric["sum"] = *m.Summary.SampleSum
-					quantiles := make(map[string]float64)
-					for _, q := range m.Summary.Quantile {
-						quantiles[fmt.Sprintf("%g", *q.Quantile)] = *q.Value
-					}
-					metric["quantiles"] = quantiles
-				case m.Histogram != nil:
-					metric["count"] = *m.Histogram.SampleCount
-					metric["sum"] = *m.Histogram.SampleSum
-					buckets := make(map[string]uint64)
-					for _, b := range m.Histogram.Bucket {
-						buckets[fmt.Sprintf("%g", *b.UpperBound)] = *b.CumulativeCount
-					}
-					metric["buckets"] = buckets
-				}
-
-				result = append(result, metric)
-			}
-		}
-
-		handle.HandleCPU(r)
-		handle.HandleMemory(r)
-		handle.HandleNetwork(r)
+		os.Exit(1)
+	}
 
-		var collectData = CollectDataStruct{
-			Memory:  *handle.Memory,
-			CPUs:    handle.CPUInfo,
-			Network: handle.Network,
-			Disks:   diskHandle.GetInfo(),
+	switch {
+	case command == captureCmd.FullCommand():
+		if err := writeCapture(logger, *captureOut, collectors, recorder, collectData); err != nil {
+			level.Error(logger).Log("msg", "Couldn't write the snapshot", "path", *captureOut, "err", err)
+			os.Exit(1)
 		}
+		level.Info(logger).Log("msg", "Snapshot written", "path", *captureOut)
+	case fixtures:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(collectData); err != nil {
+			level.Error(logger).Log("msg", "Couldn't encode the payload", "err", err)
+			os.Exit(1)
+		}
+	case command == collectCmd.FullCommand():
+		sendData(logger, collectData)
+	}
+}
 
-		// jsonFile, _ := os.Open("collect_data.json")
-		// defer jsonFile.Close()
-		// byteValue, _ := io.ReadAll(jsonFile)
-
-		// var collectData = CollectDataStruct{}
-
-		// json.Unmarshal(byteValue, &collectData)
-
-		sendData(collectData)
-
-		// file, err := os.OpenFile("collect_data.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		// if err != nil {
-		// 	fmt.Println("Error opening file:", err)
-		// 	os.Exit(1)
-		// }
-		// defer file.Close()
-
-		// // 将数据写入 JSON 文件
-		// encoder := json.NewEncoder(file)
-		// encoder.SetIndent("", "  ")
-		// if err := encoder.Encode(collectData); err != nil {
-		// 	fmt.Println("Error encoding JSON:", err)
-		// 	os.Exit(1)
-		// }
-
-		// fmt.Println("Memory metrics have been written to collect_data.json")
+// remoteConfig fetches the configuration and applies it to the flags not
+// given on the command line. It returns the collectors to run, nil to keep
+// the built-in filters.
+func remoteConfig(logger log.Logger, f *config.Fetcher) []string {
+	cfg, cached, err := f.Fetch(context.Background())
+	if err != nil {
+		level.Warn(logger).Log("msg", "Couldn't fetch the configuration", "url", f.URL, "cached", cached, "err", err)
+	}
+	if cfg == nil {
+		return nil
 	}
+	collectors, err := cfg.Apply(kingpin.CommandLine, config.Explicit(kingpin.CommandLine, os.Args[1:]))
+	if err != nil {
+		level.Error(logger).Log("msg", "Couldn't apply the configuration", "err", err)
+		os.Exit(1)
+	}
+	level.Info(logger).Log("msg", "Configuration applied", "url", f.URL, "cached", cached)
+	return collectors
 }
 
-func sendData(data CollectDataStruct) {
-	// 加载.env文件
-	err := godotenv.Load()
+// collect gathers the metrics of nc, twice when a module needs rates, and
+// builds the payload along with the status report.
+func collect(logger log.Logger, nc *collector.NodeCollector, fixtures bool) (map[string]interface{}, error) {
+	r := prometheus.NewRegistry()
+	if err := r.Register(nc); err != nil {
+		return nil, fmt.Errorf("couldn't register node collector: %w", err)
+	}
+	// A snapshot does not change: there is no point in waiting, and its
+	// rates are over the nominal interval.
+	now := time.Now
+	if fixtures {
+		now = func() time.Time { return time.Time{} }
+	}
+	start := now()
+	mfs, err := r.Gather()
 	if err != nil {
-		fmt.Println("Error loading .env file")
+		return nil, err
 	}
 
-	// url := "http://192.168.88.107:9502"
-	// 从环境变量中获取host
-	url := os.Getenv("HOST")
-	fmt.Println("url:", url)
+	in := &handle.Input{Last: mfs, LastTime: start, Report: status.NewReport()}
+	if handle.NeedsRate() {
+		if !fixtures {
+			time.Sleep(*handle.RateInterval)
+		}
+		in.Prev, in.PrevTime = mfs, start
+		in.LastTime = now()
+		if in.Last, err = r.Gather(); err != nil {
+			level.Error(logger).Log("err", err)
+		}
+	}
+	collectData := handle.BuildPayload(in)
+	for _, cs := range nc.Status() {
+		in.Report.Add(status.KindCollector, cs.Name, cs.Duration, cs.Err)
+	}
+	for _, t := range bin.ResolvedTools() {
+		in.Report.AddTool(t.Name, t.Path, t.Version, t.Duration, t.Err)
+	}
+	steps := in.Report.Steps()
+	if fixtures {
+		// Keep the payload of a snapshot the same from run to run.
+		for i := range steps {
+			steps[i].Duration = 0
+		}
+	}
+	collectData["status"] = steps
+	return collectData, nil
+}
 
-	jsonData, err := json.Marshal(data)
+// fixturesRoot returns the snapshot directory for --fixtures.dir, extracting
+// a .ttar snapshot to a temporary directory removed by cleanup.
+func fixturesRoot(path string) (dir string, cleanup func(), err error) {
+	if filepath.Ext(path) != ".ttar" {
+		return path, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	dir, err = os.MkdirTemp("", "node_exporter-fixtures-")
 	if err != nil {
-		panic(err)
+		return "", nil, err
 	}
-	utils.Log().Info("send_data:%+v", data)
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := ttar.Extract(f, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true, // 忽略证书验证
+// writeCapture archives the files read by the enabled collectors, the
+// commands they ran and the payload they produced to path.
+func writeCapture(logger log.Logger, path string, collectors []string, recorder *bin.RecordingRunner, payload map[string]interface{}) error {
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
+	// ipmitool is not run by the collectors but its sensor list is what
+	// field bugs about IPMI hardware usually need.
+	bin.RegisterTool(bin.Tool{Name: "ipmitool"})
+	if _, err := bin.RunTool("ipmitool", "sdr", "elist"); err != nil {
+		level.Debug(logger).Log("msg", "Couldn't run ipmitool", "err", err)
 	}
 
-	client := &http.Client{
-		Transport: transport,
+	globs, unknown := collector.CaptureGlobs(collectors)
+	if len(unknown) > 0 {
+		level.Warn(logger).Log("msg", "Files read by collectors are unknown, they are not captured", "collectors", strings.Join(unknown, ","))
 	}
 
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	f, err := os.Create(path)
 	if err != nil {
-		fmt.Println("Failed to send data:", err)
-		return
+		return err
+	}
+	defer f.Close()
+	tw := ttar.NewWriter(f, fmt.Sprintf("node_exporter %s snapshot, collectors: %s", version.Version, strings.Join(collectors, ",")))
+	a := capture.NewArchiver(tw, collector.CaptureRoots(), logger)
+	for _, glob := range globs {
+		if err := a.AddGlob(glob); err != nil {
+			return err
+		}
+	}
+	a.AddRecordings(recorder.Recordings())
+	a.AddFile("payload.json", append(data, '\n'))
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func sendData(logger log.Logger, data map[string]interface{}) {
+	// url := "http://192.168.88.107:9502"
+	// 从环境变量中获取host
+	url := os.Getenv("HOST")
+
+	level.Info(logger).Log("msg", "Sending payload", "url", url)
+	if jsonData, err := json.Marshal(data); err == nil {
+		level.Debug(logger).Log("msg", "Payload", "data", string(jsonData))
 	}
-	defer resp.Body.Close()
 
-	// 获取响应内容
-	respData, err := io.ReadAll(resp.Body)
+	res, err := push.NewSender(url, handle.RequiredSections).Send(context.Background(), data)
+	if len(res.Dropped) > 0 {
+		level.Warn(logger).Log("msg", "Sections dropped to fit the payload size limit", "sections", strings.Join(res.Dropped, ","))
+	}
+	if mErr := push.WriteMetrics(res, err); mErr != nil {
+		level.Error(logger).Log("msg", "Failed to write push metrics", "err", mErr)
+	}
 	if err != nil {
-		fmt.Println("Failed to read response:", err)
+		level.Error(logger).Log("msg", "Failed to send data", "status", res.StatusCode, "response", string(res.Response), "err", err)
 		return
 	}
-	currentTime := time.Now()
-	formattedTime := currentTime.Format("2006-01-02 15:04:05")
-	fmt.Println(formattedTime+", Response:", string(respData))
+	level.Info(logger).Log("msg", "Payload sent", "status", res.StatusCode, "bytes", res.Bytes, "compressed_bytes", res.CompressedBytes, "seq", res.Seq, "full", res.Full, "response", string(res.Response))
 }
@@ -0,0 +1,336 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sequence numbers the payloads pushed in delta mode. A full snapshot
+// carries Full; a patch carries the Base it applies to, the sequence number
+// of the last payload acknowledged.
+type Sequence struct {
+	Seq  uint64 `json:"seq"`
+	Base uint64 `json:"base,omitempty"`
+	Full bool   `json:"full,omitempty"`
+}
+
+// Op is a JSON patch (RFC 6902) operation: add, remove or replace.
+type Op struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is the body of a push in delta mode that is not a full snapshot.
+type Patch struct {
+	Sequence Sequence `json:"sequence"`
+	Patch    []Op     `json:"patch"`
+}
+
+// sendDelta pushes payload as a patch against the payload last acknowledged,
+// kept in StateFile. A full snapshot is pushed instead when there is no such
+// payload, the last snapshot is older than FullInterval, the patch would not
+// be smaller or the server asked for a resync; a patch the server rejects
+// asking for one is followed by a snapshot right away. MaxSize applies to
+// the snapshot, which the patch is computed from. An unreadable state file
+// is replaced once a snapshot is acknowledged.
+func (s *Sender) sendDelta(ctx context.Context, payload map[string]interface{}, now time.Time) (Result, error) {
+	st, err := LoadState(s.StateFile)
+	if err != nil {
+		st = State{}
+	}
+	seq := st.Seq + 1
+	res := Result{Seq: seq}
+
+	full := make(map[string]interface{}, len(payload)+1)
+	for name, v := range payload {
+		full[name] = v
+	}
+	full["sequence"] = Sequence{Seq: seq, Full: true}
+	raw, body, dropped, err := s.fit(full)
+	if err != nil {
+		return res, err
+	}
+	res.Dropped = dropped
+
+	// doc is the payload as the server holds it once this push is applied.
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return res, err
+	}
+	delete(doc, "sequence")
+	docRaw, err := json.Marshal(doc)
+	if err != nil {
+		return res, err
+	}
+
+	var base interface{}
+	if !st.Resync && len(st.Payload) > 0 &&
+		(s.FullInterval <= 0 || now.Sub(st.FullTime) < s.FullInterval) &&
+		json.Unmarshal(st.Payload, &base) == nil {
+		ops, err := Diff(base, doc)
+		if err != nil {
+			return res, err
+		}
+		praw, pbody, err := s.encode(Patch{Sequence: Sequence{Seq: seq, Base: st.Seq}, Patch: ops})
+		if err != nil {
+			return res, err
+		}
+		if len(pbody) < len(body) {
+			res.Bytes, res.CompressedBytes = len(praw), len(pbody)
+			err := s.post(ctx, pbody, &res)
+			if err == nil {
+				return res, s.saveState(st, seq, false, docRaw, res, now)
+			}
+			if !resyncRequested(res) {
+				return res, err
+			}
+		}
+	}
+
+	res.Full = true
+	res.Bytes, res.CompressedBytes = len(raw), len(body)
+	res.StatusCode, res.Response = 0, nil
+	if err := s.post(ctx, body, &res); err != nil {
+		return res, err
+	}
+	return res, s.saveState(st, seq, true, docRaw, res, now)
+}
+
+// resyncRequested reports whether the server asked for a full snapshot, by
+// answering 409 Conflict or with "resync": true in its response.
+func resyncRequested(res Result) bool {
+	if res.StatusCode == http.StatusConflict {
+		return true
+	}
+	var r struct {
+		Resync bool `json:"resync"`
+	}
+	return json.Unmarshal(res.Response, &r) == nil && r.Resync
+}
+
+// saveState records doc as acknowledged with sequence number seq.
+func (s *Sender) saveState(prev State, seq uint64, full bool, doc []byte, res Result, now time.Time) error {
+	st := State{Seq: seq, FullTime: prev.FullTime, Resync: resyncRequested(res), Payload: doc}
+	if full {
+		st.FullTime = now
+	}
+	if err := SaveState(s.StateFile, st); err != nil {
+		return fmt.Errorf("saving push state: %w", err)
+	}
+	return nil
+}
+
+// Diff returns the operations turning the JSON document prev into next.
+// Objects are compared key by key and arrays of the same length element by
+// element; arrays whose length changed are replaced.
+func Diff(prev, next interface{}) ([]Op, error) {
+	ops := []Op{}
+	if err := diff(&ops, "", prev, next); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func diff(ops *[]Op, path string, prev, next interface{}) error {
+	switch n := next.(type) {
+	case map[string]interface{}:
+		if p, ok := prev.(map[string]interface{}); ok {
+			for _, k := range sortedKeys(p) {
+				if _, ok := n[k]; !ok {
+					*ops = append(*ops, Op{Op: "remove", Path: path + "/" + escapePointer(k)})
+				}
+			}
+			for _, k := range sortedKeys(n) {
+				if pv, ok := p[k]; ok {
+					if err := diff(ops, path+"/"+escapePointer(k), pv, n[k]); err != nil {
+						return err
+					}
+				} else if err := addOp(ops, "add", path+"/"+escapePointer(k), n[k]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case []interface{}:
+		if p, ok := prev.([]interface{}); ok && len(p) == len(n) {
+			for i := range n {
+				if err := diff(ops, path+"/"+strconv.Itoa(i), p[i], n[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if reflect.DeepEqual(prev, next) {
+		return nil
+	}
+	return addOp(ops, "replace", path, next)
+}
+
+func addOp(ops *[]Op, op, path string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, Op{Op: op, Path: path, Value: b})
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func escapePointer(s string) string {
+	return pointerEscaper.Replace(s)
+}
+
+// Apply applies ops to the JSON document doc, as produced by Diff, and
+// returns the patched document. doc may be modified.
+func Apply(doc interface{}, ops []Op) (interface{}, error) {
+	for _, op := range ops {
+		var value interface{}
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+			}
+		}
+		var err error
+		if doc, err = apply(doc, op.Op, op.Path, value); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func apply(doc interface{}, op, path string, value interface{}) (interface{}, error) {
+	if path == "" {
+		if op != "replace" {
+			return nil, fmt.Errorf("unsupported operation on the document")
+		}
+		return value, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path")
+	}
+	key, rest, _ := strings.Cut(path[1:], "/")
+	key = pointerUnescaper.Replace(key)
+	if rest != "" {
+		rest = "/" + rest
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, ok := d[key]
+		if rest != "" {
+			if !ok {
+				return nil, fmt.Errorf("missing %q", key)
+			}
+			v, err := apply(child, op, rest, value)
+			if err != nil {
+				return nil, err
+			}
+			d[key] = v
+			return d, nil
+		}
+		switch op {
+		case "add":
+			d[key] = value
+		case "replace", "remove":
+			if !ok {
+				return nil, fmt.Errorf("missing %q", key)
+			}
+			if op == "remove" {
+				delete(d, key)
+			} else {
+				d[key] = value
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operation")
+		}
+		return d, nil
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(d) {
+			return nil, fmt.Errorf("invalid index %q", key)
+		}
+		if rest != "" {
+			if d[i], err = apply(d[i], op, rest, value); err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+		if op != "replace" {
+			return nil, fmt.Errorf("unsupported operation on an array element")
+		}
+		d[i] = value
+		return d, nil
+	}
+	return nil, fmt.Errorf("%q is not in an object or array", key)
+}
+
+// State is what delta mode keeps between runs: the last payload the
+// server acknowledged and its sequence number.
+type State struct {
+	Seq uint64 `json:"seq"`
+	// FullTime is when the last full snapshot was acknowledged.
+	FullTime time.Time `json:"full_time"`
+	// Resync is set when the server asked for a full snapshot.
+	Resync  bool            `json:"resync,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// LoadState reads the state written by SaveState. A missing file is a
+// zero State, for which a full snapshot is sent.
+func LoadState(path string) (State, error) {
+	var st State
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return State{}, fmt.Errorf("invalid push state %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// SaveState replaces the state file atomically.
+func SaveState(path string, st State) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,242 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffApply(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		prev, next string
+		want       string
+	}{
+		{
+			name: "unchanged",
+			prev: `{"memory":{"total":1024,"free":512}}`,
+			next: `{"memory":{"total":1024,"free":512}}`,
+			want: `[]`,
+		},
+		{
+			name: "nested value",
+			prev: `{"memory":{"total":1024,"free":512}}`,
+			next: `{"memory":{"total":1024,"free":256}}`,
+			want: `[{"op":"replace","path":"/memory/free","value":256}]`,
+		},
+		{
+			name: "keys added and removed",
+			prev: `{"network":{"eth0":{"receive":1},"tun0":{"receive":2}}}`,
+			next: `{"network":{"eth0":{"receive":1},"wlan0":{"receive":3}}}`,
+			want: `[{"op":"remove","path":"/network/tun0"},{"op":"add","path":"/network/wlan0","value":{"receive":3}}]`,
+		},
+		{
+			name: "escaped keys",
+			prev: `{"logs":{"/var/log/a~b":"x"}}`,
+			next: `{"logs":{"/var/log/a~b":"y"}}`,
+			want: `[{"op":"replace","path":"/logs/~1var~1log~1a~0b","value":"y"}]`,
+		},
+		{
+			name: "array elements",
+			prev: `{"cpus":{"usage":[{"cpu":"0","value":0.1},{"cpu":"1","value":0.2}]}}`,
+			next: `{"cpus":{"usage":[{"cpu":"0","value":0.1},{"cpu":"1","value":0.3}]}}`,
+			want: `[{"op":"replace","path":"/cpus/usage/1/value","value":0.3}]`,
+		},
+		{
+			name: "array resized",
+			prev: `{"disks":[{"name":"sda"}]}`,
+			next: `{"disks":[{"name":"sda"},{"name":"sdb"}]}`,
+			want: `[{"op":"replace","path":"/disks","value":[{"name":"sda"},{"name":"sdb"}]}]`,
+		},
+		{
+			name: "null and type changes",
+			prev: `{"network":{"eth0":{"receive_rate":null}},"disks":null}`,
+			next: `{"network":{"eth0":{"receive_rate":12.5}},"disks":[]}`,
+			want: `[{"op":"replace","path":"/disks","value":[]},{"op":"replace","path":"/network/eth0/receive_rate","value":12.5}]`,
+		},
+		{
+			name: "value to null",
+			prev: `{"network":{"eth0":{"receive_rate":12.5}}}`,
+			next: `{"network":{"eth0":{"receive_rate":null}}}`,
+			want: `[{"op":"replace","path":"/network/eth0/receive_rate","value":null}]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var prev, next interface{}
+			if err := json.Unmarshal([]byte(tc.prev), &prev); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.next), &next); err != nil {
+				t.Fatal(err)
+			}
+			ops, err := Diff(prev, next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.want {
+				t.Errorf("unexpected patch:\n%s\nwant:\n%s", b, tc.want)
+			}
+
+			var roundTrip []Op
+			if err := json.Unmarshal(b, &roundTrip); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(prev, roundTrip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, next) {
+				t.Errorf("patched document %v, want %v", got, next)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		op   Op
+	}{
+		{name: "missing key", op: Op{Op: "replace", Path: "/memory/used", Value: json.RawMessage(`1`)}},
+		{name: "missing parent", op: Op{Op: "add", Path: "/load/avg", Value: json.RawMessage(`1`)}},
+		{name: "index out of range", op: Op{Op: "replace", Path: "/disks/2", Value: json.RawMessage(`{}`)}},
+		{name: "add to an array", op: Op{Op: "add", Path: "/disks/0", Value: json.RawMessage(`{}`)}},
+		{name: "path into a value", op: Op{Op: "replace", Path: "/memory/free/x", Value: json.RawMessage(`1`)}},
+		{name: "unsupported op", op: Op{Op: "move", Path: "/memory/free", Value: json.RawMessage(`1`)}},
+		{name: "relative path", op: Op{Op: "replace", Path: "memory", Value: json.RawMessage(`1`)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(`{"memory":{"free":1},"disks":[{"name":"sda"}]}`), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Apply(doc, []Op{tc.op}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// deltaReceiver records the bodies posted to it and answers with the
+// queued responses, then 200.
+type deltaReceiver struct {
+	bodies    []map[string]json.RawMessage
+	responses []int
+	resync    bool
+}
+
+func (rc *deltaReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.bodies = append(rc.bodies, body)
+	code := http.StatusOK
+	if len(rc.responses) > 0 {
+		code, rc.responses = rc.responses[0], rc.responses[1:]
+	}
+	w.WriteHeader(code)
+	if rc.resync {
+		io.WriteString(w, `{"status":"ok","resync":true}`)
+		rc.resync = false
+		return
+	}
+	io.WriteString(w, `{"status":"ok"}`)
+}
+
+func TestSendDelta(t *testing.T) {
+	rc := &deltaReceiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	s := &Sender{
+		URL:          srv.URL,
+		Delta:        true,
+		StateFile:    filepath.Join(t.TempDir(), "push_state.json"),
+		FullInterval: time.Hour,
+	}
+	now := time.Unix(1700000000, 0)
+	payload := testPayload()
+	send := func(name string, wantSeq uint64, wantFull bool) map[string]json.RawMessage {
+		t.Helper()
+		n := len(rc.bodies)
+		res, err := s.sendDelta(context.Background(), payload, now)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if res.Seq != wantSeq || res.Full != wantFull {
+			t.Errorf("%s: expected seq %d, full %v, got %d, %v", name, wantSeq, wantFull, res.Seq, res.Full)
+		}
+		if len(rc.bodies) == n {
+			t.Fatalf("%s: nothing posted", name)
+		}
+		return rc.bodies[len(rc.bodies)-1]
+	}
+
+	body := send("no state", 1, true)
+	if string(body["sequence"]) != `{"seq":1,"full":true}` || body["processes"] == nil {
+		t.Errorf("expected a full snapshot, got %v", body)
+	}
+
+	payload["memory"] = map[string]float64{"total": 1024, "free": 256}
+	now = now.Add(time.Minute)
+	body = send("changed", 2, false)
+	if string(body["sequence"]) != `{"seq":2,"base":1}` ||
+		string(body["patch"]) != `[{"op":"replace","path":"/memory/free","value":256}]` {
+		t.Errorf("expected a patch of the free memory, got %v", body)
+	}
+
+	rc.responses = []int{http.StatusConflict}
+	now = now.Add(time.Minute)
+	n := len(rc.bodies)
+	body = send("gap", 3, true)
+	if len(rc.bodies) != n+2 || string(body["sequence"]) != `{"seq":3,"full":true}` {
+		t.Errorf("expected the rejected patch to be followed by a snapshot, got %d bodies, last %v", len(rc.bodies)-n, body)
+	}
+
+	rc.resync = true
+	now = now.Add(time.Minute)
+	send("resync requested", 4, false)
+	send("after resync", 5, true)
+
+	now = now.Add(time.Hour)
+	send("full interval", 6, true)
+
+	rc.responses = []int{http.StatusServiceUnavailable}
+	if _, err := s.sendDelta(context.Background(), payload, now); err == nil {
+		t.Error("expected an error from the server")
+	}
+	body = send("after failure", 7, false)
+	if string(body["sequence"]) != `{"seq":7,"base":6}` {
+		t.Errorf("expected the failed push to be retried against the acknowledged payload, got %s", body["sequence"])
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push_state.json")
+	if st, err := LoadState(path); err != nil || st.Seq != 0 || st.Payload != nil {
+		t.Fatalf("expected a zero state without a file, got %+v, %v", st, err)
+	}
+	want := State{Seq: 3, FullTime: time.Unix(1700000000, 0).UTC(), Payload: json.RawMessage(`{"memory":{}}`)}
+	if err := SaveState(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
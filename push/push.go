@@ -0,0 +1,284 @@
+// Package push sends the payload to the HOST endpoint, compressed and
+// within a size limit, in full or as a patch against the last payload
+// acknowledged.
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"go_collector/handle/status"
+	"go_collector/utils"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	compression = kingpin.Flag(
+		"push.compression",
+		"Compression of the pushed payload, sent as its Content-Encoding: none, gzip or zstd.",
+	).Default("none").Enum("none", "gzip", "zstd")
+	maxSize = kingpin.Flag(
+		"push.max-size",
+		"Largest payload pushed, after compression. Optional sections are dropped, largest first, until it fits; 0 disables the limit.",
+	).Default("0").Bytes()
+	metricsFile = kingpin.Flag(
+		"push.metrics-file",
+		"File the sizes of the last push are written to in the Prometheus text format, e.g. in the --collector.textfile.directory.",
+	).Default("").String()
+	insecureSkipVerify = kingpin.Flag(
+		"push.insecure-skip-verify",
+		"Do not verify the certificate of the HOST endpoint.",
+	).Default("true").Bool()
+	delta = kingpin.Flag(
+		"push.delta",
+		"Push a JSON patch against the last payload the server acknowledged instead of the full payload.",
+	).Default("false").Bool()
+	stateFile = kingpin.Flag(
+		"push.state-file",
+		"File the last acknowledged payload and its sequence number are kept in with --push.delta, relative to the directory of the executable.",
+	).Default("push_state.json").String()
+	fullInterval = kingpin.Flag(
+		"push.full-interval",
+		"With --push.delta, push a full snapshot when the last one is older than this; 0 only sends one when there is no state or the server asks for it.",
+	).Default("1h").Duration()
+)
+
+// Sender posts payloads to URL.
+type Sender struct {
+	URL    string
+	Client *http.Client
+	// Compression is "none", "gzip" or "zstd".
+	Compression string
+	// MaxSize is the largest body posted, 0 for no limit.
+	MaxSize int
+	// Required are the sections never dropped to fit MaxSize.
+	Required []string
+	// Delta sends patches against the payload last acknowledged, kept in
+	// StateFile, and a full snapshot every FullInterval.
+	Delta        bool
+	StateFile    string
+	FullInterval time.Duration
+}
+
+// NewSender returns a Sender to url configured by the --push.* flags.
+func NewSender(url string, required []string) *Sender {
+	return &Sender{
+		URL: url,
+		Client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecureSkipVerify}},
+		},
+		Compression:  *compression,
+		MaxSize:      int(*maxSize),
+		Required:     required,
+		Delta:        *delta,
+		StateFile:    utils.ExeRelative(*stateFile),
+		FullInterval: *fullInterval,
+	}
+}
+
+// Result describes a push.
+type Result struct {
+	// Bytes is the size of the JSON payload posted and CompressedBytes the
+	// size of the request body.
+	Bytes           int
+	CompressedBytes int
+	// Dropped are the sections left out to fit MaxSize.
+	Dropped    []string
+	StatusCode int
+	Response   []byte
+	// Seq is the sequence number of the push in delta mode, and Full whether
+	// it was a full snapshot rather than a patch.
+	Seq  uint64
+	Full bool
+}
+
+// Send posts payload. When it is over MaxSize, optional sections are
+// dropped and recorded as failed steps in its "status" section.
+func (s *Sender) Send(ctx context.Context, payload map[string]interface{}) (Result, error) {
+	if s.Delta {
+		return s.sendDelta(ctx, payload, time.Now())
+	}
+	var res Result
+	raw, body, dropped, err := s.fit(payload)
+	if err != nil {
+		return res, err
+	}
+	res.Bytes, res.CompressedBytes, res.Dropped = len(raw), len(body), dropped
+	return res, s.post(ctx, body, &res)
+}
+
+// post sends body and records the response in res.
+func (s *Sender) post(ctx context.Context, body []byte, res *Result) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Compression != "none" && s.Compression != "" {
+		req.Header.Set("Content-Encoding", s.Compression)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+	if res.Response, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fit encodes payload, dropping optional sections, largest first, until the
+// body fits MaxSize. The dropped sections are returned, and added to the
+// "status" section of the body, which payload is left untouched by.
+func (s *Sender) fit(payload map[string]interface{}) (raw, body []byte, dropped []string, err error) {
+	raw, body, err = s.encode(payload)
+	if err != nil || s.MaxSize <= 0 || len(body) <= s.MaxSize {
+		return raw, body, nil, err
+	}
+
+	required := map[string]bool{"status": true, "sequence": true}
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	type section struct {
+		name string
+		size int
+	}
+	var optional []section
+	for name, v := range payload {
+		if required[name] {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		optional = append(optional, section{name, len(b)})
+	}
+	sort.Slice(optional, func(i, j int) bool {
+		if optional[i].size != optional[j].size {
+			return optional[i].size > optional[j].size
+		}
+		return optional[i].name < optional[j].name
+	})
+
+	trimmed := make(map[string]interface{}, len(payload))
+	for name, v := range payload {
+		trimmed[name] = v
+	}
+	steps, hasStatus := payload["status"].([]status.Step)
+	steps = append([]status.Step{}, steps...)
+	for _, sec := range optional {
+		delete(trimmed, sec.name)
+		dropped = append(dropped, sec.name)
+		if hasStatus {
+			steps = append(steps, status.Step{
+				Kind:  status.KindPush,
+				Name:  sec.name,
+				Error: fmt.Sprintf("section of %d bytes dropped to fit the %d bytes payload limit", sec.size, s.MaxSize),
+			})
+			trimmed["status"] = steps
+		}
+		if raw, body, err = s.encode(trimmed); err != nil {
+			return nil, nil, nil, err
+		}
+		if len(body) <= s.MaxSize {
+			return raw, body, dropped, nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("payload of %d bytes is over the %d bytes limit with only the required sections", len(body), s.MaxSize)
+}
+
+// encode returns the JSON encoding of payload and the request body, the
+// encoding compressed as configured.
+func (s *Sender) encode(payload interface{}) (raw, body []byte, err error) {
+	raw, err = json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	switch s.Compression {
+	case "", "none":
+		return raw, raw, nil
+	case "gzip":
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(raw); err != nil {
+			return nil, nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, nil, err
+		}
+	case "zstd":
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return nil, nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown compression %q", s.Compression)
+	}
+	return raw, buf.Bytes(), nil
+}
+
+// WriteMetrics writes the outcome of a push to the --push.metrics-file, if
+// set, for the textfile collector to report it on the next run.
+func WriteMetrics(res Result, err error) error {
+	if *metricsFile == "" {
+		return nil
+	}
+	return writeMetrics(*metricsFile, res, err, time.Now())
+}
+
+func writeMetrics(path string, res Result, err error, now time.Time) error {
+	size := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_exporter_push_payload_bytes",
+		Help: "Size of the last pushed payload, before and after compression.",
+	}, []string{"stage"})
+	size.WithLabelValues("uncompressed").Set(float64(res.Bytes))
+	size.WithLabelValues("compressed").Set(float64(res.CompressedBytes))
+	dropped := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "node_exporter_push_dropped_sections",
+		Help: "Number of sections dropped from the last pushed payload to fit --push.max-size.",
+	})
+	dropped.Set(float64(len(res.Dropped)))
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "node_exporter_push_success",
+		Help: "Whether the last push succeeded.",
+	})
+	if err == nil {
+		success.Set(1)
+	}
+	timestamp := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "node_exporter_push_timestamp_seconds",
+		Help: "Time of the last push.",
+	})
+	timestamp.Set(float64(now.UnixNano()) / 1e9)
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(size, dropped, success, timestamp)
+	return prometheus.WriteToTextfile(path, r)
+}
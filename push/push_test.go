@@ -0,0 +1,189 @@
+package push
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"go_collector/handle/status"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// receiver records the decoded payloads posted to it.
+type receiver struct {
+	code     int
+	encoding string
+	payloads []map[string]json.RawMessage
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.encoding = r.Header.Get("Content-Encoding")
+	var body io.Reader = r.Body
+	switch rc.encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	var payload map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.payloads = append(rc.payloads, payload)
+	if rc.code != 0 {
+		w.WriteHeader(rc.code)
+	}
+	io.WriteString(w, `{"status":"ok"}`)
+}
+
+func testPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"memory":    map[string]float64{"total": 1024, "free": 512},
+		"network":   map[string]interface{}{},
+		"processes": strings.Repeat("x", 4096),
+		"kernel":    "small",
+		"status":    []status.Step{{Kind: status.KindHandle, Name: "memory", Success: true}},
+	}
+}
+
+func TestSendCompression(t *testing.T) {
+	for _, compression := range []string{"none", "gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			rc := &receiver{}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+
+			s := &Sender{URL: srv.URL, Compression: compression}
+			res, err := s.Send(context.Background(), testPayload())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := compression
+			if compression == "none" {
+				want = ""
+			}
+			if rc.encoding != want {
+				t.Errorf("expected Content-Encoding %q, got %q", want, rc.encoding)
+			}
+			raw, _ := json.Marshal(testPayload())
+			if res.Bytes != len(raw) {
+				t.Errorf("expected %d bytes, got %d", len(raw), res.Bytes)
+			}
+			if compression == "none" && res.CompressedBytes != res.Bytes {
+				t.Errorf("expected uncompressed body, got %d bytes for %d", res.CompressedBytes, res.Bytes)
+			}
+			if compression != "none" && res.CompressedBytes >= res.Bytes {
+				t.Errorf("expected compressed body, got %d bytes for %d", res.CompressedBytes, res.Bytes)
+			}
+			if len(rc.payloads) != 1 || len(rc.payloads[0]) != len(testPayload()) {
+				t.Errorf("unexpected payloads received: %v", rc.payloads)
+			}
+		})
+	}
+}
+
+func TestSendMaxSize(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	payload := testPayload()
+	s := &Sender{URL: srv.URL, Compression: "none", MaxSize: 1024, Required: []string{"memory", "network"}}
+	res, err := s.Send(context.Background(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Dropped, []string{"processes"}) {
+		t.Errorf("expected the largest optional section to be dropped, got %v", res.Dropped)
+	}
+	if res.CompressedBytes > s.MaxSize {
+		t.Errorf("expected at most %d bytes, got %d", s.MaxSize, res.CompressedBytes)
+	}
+	if _, ok := payload["processes"]; !ok {
+		t.Error("expected the payload passed to be left untouched")
+	}
+
+	got := rc.payloads[0]
+	if _, ok := got["processes"]; ok {
+		t.Error("expected processes to be dropped")
+	}
+	if _, ok := got["kernel"]; !ok {
+		t.Error("expected kernel to be kept")
+	}
+	var steps []status.Step
+	if err := json.Unmarshal(got["status"], &steps); err != nil {
+		t.Fatal(err)
+	}
+	if last := steps[len(steps)-1]; last.Kind != status.KindPush || last.Name != "processes" || last.Success {
+		t.Errorf("expected the dropped section to be reported, got %+v", last)
+	}
+
+	s.MaxSize = 16
+	if _, err := s.Send(context.Background(), testPayload()); err == nil {
+		t.Error("expected an error when the required sections are over the limit")
+	}
+	if len(rc.payloads) != 1 {
+		t.Errorf("expected nothing to be posted over the limit, got %d payloads", len(rc.payloads))
+	}
+}
+
+func TestSendServerError(t *testing.T) {
+	srv := httptest.NewServer(&receiver{code: http.StatusServiceUnavailable})
+	defer srv.Close()
+
+	res, err := (&Sender{URL: srv.URL}).Send(context.Background(), testPayload())
+	if err == nil || res.StatusCode != http.StatusServiceUnavailable || string(res.Response) != `{"status":"ok"}` {
+		t.Errorf("expected the status and response along with an error, got %d, %q, %v", res.StatusCode, res.Response, err)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push.prom")
+	res := Result{Bytes: 4096, CompressedBytes: 512, Dropped: []string{"processes"}}
+	if err := writeMetrics(path, res, errors.New("server returned 503"), time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP node_exporter_push_dropped_sections Number of sections dropped from the last pushed payload to fit --push.max-size.
+# TYPE node_exporter_push_dropped_sections gauge
+node_exporter_push_dropped_sections 1
+# HELP node_exporter_push_payload_bytes Size of the last pushed payload, before and after compression.
+# TYPE node_exporter_push_payload_bytes gauge
+node_exporter_push_payload_bytes{stage="compressed"} 512
+node_exporter_push_payload_bytes{stage="uncompressed"} 4096
+# HELP node_exporter_push_success Whether the last push succeeded.
+# TYPE node_exporter_push_success gauge
+node_exporter_push_success 0
+# HELP node_exporter_push_timestamp_seconds Time of the last push.
+# TYPE node_exporter_push_timestamp_seconds gauge
+node_exporter_push_timestamp_seconds 1.7e+09
+`
+	if string(got) != want {
+		t.Errorf("unexpected metrics:\n%s\nwant:\n%s", got, want)
+	}
+}
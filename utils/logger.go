@@ -1,106 +1,66 @@
 package utils
 
 import (
-	"fmt"
 	"os"
-	"time"
-)
+	"sync"
 
-const (
-	// LevelError 错误
-	LevelError = iota
-	// LevelWarning 警告
-	LevelWarning
-	// LevelInformational 提示
-	LevelInformational
-	// LevelDebug 除错
-	LevelDebug
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/alecthomas/units"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/common/promlog/flag"
 )
 
-var logger *Logger
-
-// Logger 日志
-type Logger struct {
-	level int
+// LogConfig is the promlog level and format, plus the optional log file.
+type LogConfig struct {
+	promlog.Config
+	// File is the log file; empty means standard error.
+	File       string
+	MaxSize    units.Base2Bytes
+	MaxBackups int
 }
 
-// Println 打印
-func (ll *Logger) Println(msg string) {
-	fmt.Printf("%s %s", time.Now().Format("2006-01-02 15:04:05 -0700"), msg)
-}
+var (
+	loggerMtx sync.RWMutex
+	logger    = level.NewFilter(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), level.AllowInfo())
+)
 
-// Panic 极端错误
-func (ll *Logger) Panic(format string, v ...interface{}) {
-	if LevelError > ll.level {
-		return
-	}
-	msg := fmt.Sprintf("[Panic] "+format, v...)
-	ll.Println(msg)
-	os.Exit(0)
+// AddLogFlags adds --log.level, --log.format and the log file flags to a.
+func AddLogFlags(a *kingpin.Application, config *LogConfig) {
+	flag.AddFlags(a, &config.Config)
+	a.Flag("log.file", "Write the log to this file instead of standard error.").Default("").StringVar(&config.File)
+	a.Flag("log.max-size", "Size at which the log file is rotated, 0 to never rotate.").Default("10MiB").BytesVar(&config.MaxSize)
+	a.Flag("log.max-backups", "Number of rotated log files kept.").Default("3").IntVar(&config.MaxBackups)
 }
 
-// Error 错误
-func (ll *Logger) Error(format string, v ...interface{}) {
-	if LevelError > ll.level {
-		return
+// NewLogger returns the leveled logfmt or JSON logger described by config.
+func NewLogger(config *LogConfig) (log.Logger, error) {
+	if config.File == "" {
+		return promlog.New(&config.Config), nil
 	}
-	msg := fmt.Sprintf("[E] "+format, v...)
-	ll.Println(msg)
-}
-
-// Warning 警告
-func (ll *Logger) Warning(format string, v ...interface{}) {
-	if LevelWarning > ll.level {
-		return
+	w, err := OpenRotatingFile(config.File, int64(config.MaxSize), config.MaxBackups)
+	if err != nil {
+		return nil, err
 	}
-	msg := fmt.Sprintf("[W] "+format, v...)
-	ll.Println(msg)
-}
-
-// Info 信息
-func (ll *Logger) Info(format string, v ...interface{}) {
-	if LevelInformational > ll.level {
-		return
+	if config.Format != nil && config.Format.String() == "json" {
+		return promlog.NewWithLogger(log.NewJSONLogger(log.NewSyncWriter(w)), &config.Config), nil
 	}
-	msg := fmt.Sprintf("[I] "+format, v...)
-	ll.Println(msg)
+	return promlog.NewWithLogger(log.NewLogfmtLogger(log.NewSyncWriter(w)), &config.Config), nil
 }
 
-// Debug 校验
-func (ll *Logger) Debug(format string, v ...interface{}) {
-	if LevelDebug > ll.level {
-		return
-	}
-	msg := fmt.Sprintf("[D] "+format, v...)
-	ll.Println(msg)
+// SetLogger sets the logger returned by Logger. It is the logger handed to
+// the collectors, so that the whole agent logs the same way.
+func SetLogger(l log.Logger) {
+	loggerMtx.Lock()
+	defer loggerMtx.Unlock()
+	logger = l
 }
 
-// BuildLogger 构建logger
-func BuildLogger(level string) {
-	intLevel := LevelError
-	switch level {
-	case "error":
-		intLevel = LevelError
-	case "warning":
-		intLevel = LevelWarning
-	case "info":
-		intLevel = LevelInformational
-	case "debug":
-		intLevel = LevelDebug
-	}
-	l := Logger{
-		level: intLevel,
-	}
-	logger = &l
-}
-
-// Log 返回日志对象
-func Log() *Logger {
-	if logger == nil {
-		l := Logger{
-			level: LevelDebug,
-		}
-		logger = &l
-	}
+// Logger returns the logger of the packages that are not given one, logging
+// at info level to standard error until SetLogger is called.
+func Logger() log.Logger {
+	loggerMtx.RLock()
+	defer loggerMtx.RUnlock()
 	return logger
 }
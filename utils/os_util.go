@@ -2,11 +2,11 @@
 package utils
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
+
+	"github.com/go-kit/log/level"
 )
 
 func GetOsType() string {
@@ -18,43 +18,28 @@ func GetOsType() string {
 		// fmt.Println("Linux")
 		return "linux"
 	} else {
-		fmt.Println("Unknown")
+		level.Warn(Logger()).Log("msg", "Unknown OS", "os", runtime.GOOS)
 		return "unknown"
 	}
 }
 
+// GetBinDir returns the bin directory next to the executable, holding the
+// bundled tools.
 func GetBinDir() string {
-	if IsTesting() {
-		wd, err := os.Getwd()
-		if err != nil {
-			fmt.Println(err)
-		}
-		dir := ""
-		osType := GetOsType()
-		switch osType {
-		case "linux":
-			dir = wd + "/bin/linux"
-		case "windows":
-			dir = wd + "\\bin\\windows"
-		default:
-			fmt.Println("Unknown OS")
-		}
-
-		return dir
-	} else {
-		fmt.Println("exec binary")
-		exePath, err := os.Executable()
-		if err != nil {
-			panic(err)
-		}
-		exeDir := filepath.Dir(exePath)
-		templatesDir := filepath.Join(exeDir, "bin")
-		fmt.Println("templatesDir:", templatesDir)
-		return templatesDir
-	}
+	return ExeRelative("bin")
 }
 
-func IsTesting() bool {
-	args := os.Args
-	return len(args) > 0 && strings.Contains(strings.ToLower(os.Args[0]), "go-build")
+// ExeRelative resolves a relative path against the directory of the
+// executable, so that the files kept between runs do not depend on the
+// working directory cron or systemd start the agent from.
+func ExeRelative(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		level.Error(Logger()).Log("msg", "Couldn't find the executable", "err", err)
+		return path
+	}
+	return filepath.Join(filepath.Dir(exePath), path)
 }
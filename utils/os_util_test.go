@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExeRelative(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{path: "", want: ""},
+		{path: "/var/lib/go_collector/state", want: "/var/lib/go_collector/state"},
+		{path: "state", want: filepath.Join(filepath.Dir(exe), "state")},
+		{path: "data/push_state.json", want: filepath.Join(filepath.Dir(exe), "data", "push_state.json")},
+	} {
+		if got := ExeRelative(tc.path); got != tc.want {
+			t.Errorf("ExeRelative(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	if err := os.WriteFile(path, []byte("old run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRotatingFile(path, 16, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// "old run\nfirst\n" is rotated out twice and dropped.
+	for _, line := range []string{"first\n", "second line\n", "third line\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third line\n",
+		path + ".2": "second line\n",
+	}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: want %q, got %q", file, content, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 rotated files, got %v", err)
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	r, err := OpenRotatingFile(path, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "second\n" {
+		t.Errorf("want %q, got %q (%v)", "second\n", got, err)
+	}
+}
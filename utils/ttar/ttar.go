@@ -0,0 +1,191 @@
+// Package ttar reads and writes ttar archives, the plain text archives the
+// collector fixtures are stored in (collector/fixtures/sys.ttar).
+package ttar
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const separator = "# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -"
+
+// Writer writes a ttar archive. Parent directories are written before the
+// entries in them.
+type Writer struct {
+	w    *bufio.Writer
+	dirs map[string]bool
+	err  error
+}
+
+// NewWriter returns a Writer to w starting with the comment line.
+func NewWriter(w io.Writer, comment string) *Writer {
+	tw := &Writer{w: bufio.NewWriter(w), dirs: map[string]bool{}}
+	if comment != "" {
+		tw.printf("# %s\n", comment)
+	}
+	return tw
+}
+
+func (tw *Writer) printf(format string, a ...interface{}) {
+	if tw.err == nil {
+		_, tw.err = fmt.Fprintf(tw.w, format, a...)
+	}
+}
+
+func (tw *Writer) parents(name string) {
+	if dir := path.Dir(name); dir != "." && dir != "/" {
+		tw.Dir(dir, 0o755)
+	}
+}
+
+// Dir adds a directory, once.
+func (tw *Writer) Dir(name string, mode os.FileMode) {
+	name = path.Clean(name)
+	if tw.dirs[name] {
+		return
+	}
+	tw.parents(name)
+	tw.dirs[name] = true
+	tw.printf("Directory: %s\nMode: %o\n%s\n", name, mode.Perm(), separator)
+}
+
+// File adds a file holding data.
+func (tw *Writer) File(name string, data []byte, mode os.FileMode) {
+	name = path.Clean(name)
+	tw.parents(name)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	tw.printf("Path: %s\nLines: %d\n", name, len(lines))
+	for _, line := range lines {
+		line = bytes.ReplaceAll(line, []byte{0}, []byte("NULLBYTE"))
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			// The last line of a file not ending with a newline.
+			line = append(line, "EOF\n"...)
+		}
+		if tw.err == nil {
+			_, tw.err = tw.w.Write(line)
+		}
+	}
+	tw.printf("Mode: %o\n%s\n", mode.Perm(), separator)
+}
+
+// Symlink adds a symbolic link to target.
+func (tw *Writer) Symlink(name, target string) {
+	name = path.Clean(name)
+	tw.parents(name)
+	tw.printf("Path: %s\nSymlinkTo: %s\n%s\n", name, target, separator)
+}
+
+// Close flushes the archive and returns the first error met writing it.
+// It does not close the underlying writer.
+func (tw *Writer) Close() error {
+	if tw.err == nil {
+		tw.err = tw.w.Flush()
+	}
+	return tw.err
+}
+
+// Extract extracts the archive read from r into dir.
+func Extract(r io.Reader, dir string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	lineNo := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNo++
+		return scanner.Text(), true
+	}
+
+	var current string
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		key, value, _ := strings.Cut(line, ": ")
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		switch key {
+		case "Directory", "Path":
+			target, err := entryPath(dir, value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			current = target
+			if key == "Directory" {
+				if err := os.MkdirAll(current, 0o755); err != nil {
+					return err
+				}
+			}
+		case "Lines":
+			n, err := strconv.Atoi(value)
+			if err != nil || current == "" {
+				return fmt.Errorf("line %d: invalid %q", lineNo, line)
+			}
+			var data bytes.Buffer
+			for i := 0; i < n; i++ {
+				content, ok := next()
+				if !ok {
+					return fmt.Errorf("line %d: unexpected end of archive", lineNo)
+				}
+				content = strings.ReplaceAll(content, "NULLBYTE", "\x00")
+				if i == n-1 && strings.HasSuffix(content, "EOF") {
+					data.WriteString(strings.TrimSuffix(content, "EOF"))
+				} else {
+					data.WriteString(content + "\n")
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(current), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(current, data.Bytes(), 0o644); err != nil {
+				return err
+			}
+		case "SymlinkTo":
+			if current == "" {
+				return fmt.Errorf("line %d: symlink without a path", lineNo)
+			}
+			if err := os.MkdirAll(filepath.Dir(current), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(value, current); err != nil {
+				return err
+			}
+		case "Mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || current == "" {
+				return fmt.Errorf("line %d: invalid %q", lineNo, line)
+			}
+			// Keep extracted entries readable, whatever their mode.
+			if err := os.Chmod(current, os.FileMode(mode)|0o600); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line %d: unexpected %q", lineNo, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// entryPath returns where the archive entry name goes in dir, refusing
+// names that would leave it.
+func entryPath(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("entry %q is outside of the archive", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
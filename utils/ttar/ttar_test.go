@@ -0,0 +1,80 @@
+package ttar
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tw := NewWriter(&buf, "Archive created by test")
+	tw.File("sys/class/net/eth0/mtu", []byte("1500\n"), 0o644)
+	tw.File("sys/class/net/eth0/alias", nil, 0o644)
+	tw.File("proc/1/cmdline", []byte("/sbin/init\x00splash"), 0o444)
+	tw.Symlink("sys/class/net/lo", "../../devices/virtual/net/lo")
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sep := separator + "\n"
+	want := "# Archive created by test\n" +
+		"Directory: sys\nMode: 755\n" + sep +
+		"Directory: sys/class\nMode: 755\n" + sep +
+		"Directory: sys/class/net\nMode: 755\n" + sep +
+		"Directory: sys/class/net/eth0\nMode: 755\n" + sep +
+		"Path: sys/class/net/eth0/mtu\nLines: 1\n1500\nMode: 644\n" + sep +
+		"Path: sys/class/net/eth0/alias\nLines: 0\nMode: 644\n" + sep +
+		"Directory: proc\nMode: 755\n" + sep +
+		"Directory: proc/1\nMode: 755\n" + sep +
+		"Path: proc/1/cmdline\nLines: 1\n/sbin/initNULLBYTEsplashEOF\nMode: 444\n" + sep +
+		"Path: sys/class/net/lo\nSymlinkTo: ../../devices/virtual/net/lo\n" + sep
+	if buf.String() != want {
+		t.Errorf("unexpected archive:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"proc/meminfo":           "MemTotal:       16384 kB\nMemFree:         1024 kB\n",
+		"proc/1/cmdline":         "/sbin/init\x00splash\x00",
+		"sys/class/net/eth0/mtu": "1500",
+		"udev/data/b8:0":         "",
+		"commands/smartctl.out":  "line one\n\nline three\n",
+	}
+	var buf bytes.Buffer
+	tw := NewWriter(&buf, "")
+	for name, content := range files {
+		tw.File(name, []byte(content), 0o644)
+	}
+	tw.Symlink("sys/class/net/eth1", "eth0")
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := Extract(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: want %q, got %q", name, content, got)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "sys/class/net/eth1")); err != nil || target != "eth0" {
+		t.Errorf("unexpected symlink %q, %v", target, err)
+	}
+}
+
+func TestExtractRejectsEscapingPaths(t *testing.T) {
+	archive := "Path: ../outside\nLines: 1\nx\nMode: 644\n" + separator + "\n"
+	if err := Extract(strings.NewReader(archive), t.TempDir()); err == nil {
+		t.Error("expected an error for a path outside of the archive")
+	}
+}